@@ -0,0 +1,143 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+/*
+The offer file describes accelerators with the gpu and gpuMemory attributes, the accelerator model (accelerator, i.e.
+"NVIDIA V100") and, for the instances that carry other kinds, a count per kind (inferentia, trainium, fpga). The
+kind is the attribute the count came in, or else follows from the model. Older offers leave some of this out, so the
+instance family table below is only a fallback for what the attributes don't say.
+*/
+
+// acceleratorAttributes are the offer attributes counting accelerators, by kind.
+var acceleratorAttributes = []struct {
+	Name string
+	Kind string
+}{
+	{"gpu", "GPU"},
+	{"inferentia", "Inferentia"},
+	{"trainium", "Trainium"},
+	{"fpga", "FPGA"},
+}
+
+// acceleratorKinds tells the kind of an accelerator from its model when no count attribute does, GPU otherwise.
+var acceleratorKinds = []struct {
+	Match string
+	Kind  string
+}{
+	{"INFERENTIA", "Inferentia"},
+	{"TRAINIUM", "Trainium"},
+	{"FPGA", "FPGA"},
+	{"GAUDI", "Gaudi"},
+	{"QUALCOMM", "Qualcomm AI"},
+}
+
+// acceleratorFamily describes the accelerators fitted to an instance family.
+type acceleratorFamily struct {
+	Model string // i.e. NVIDIA V100, AWS Inferentia2, Xilinx FPGA
+	Kind  string // GPU, Inferentia, Trainium, FPGA ...
+}
+
+var acceleratorFamilies = map[string]acceleratorFamily{
+	"p2":    {"NVIDIA K80", "GPU"},
+	"p3":    {"NVIDIA V100", "GPU"},
+	"p3dn":  {"NVIDIA V100", "GPU"},
+	"p4d":   {"NVIDIA A100", "GPU"},
+	"p4de":  {"NVIDIA A100", "GPU"},
+	"p5":    {"NVIDIA H100", "GPU"},
+	"p5e":   {"NVIDIA H200", "GPU"},
+	"p5en":  {"NVIDIA H200", "GPU"},
+	"g2":    {"NVIDIA GRID K520", "GPU"},
+	"g3":    {"NVIDIA M60", "GPU"},
+	"g3s":   {"NVIDIA M60", "GPU"},
+	"g4dn":  {"NVIDIA T4", "GPU"},
+	"g4ad":  {"AMD Radeon Pro V520", "GPU"},
+	"g5":    {"NVIDIA A10G", "GPU"},
+	"g5g":   {"NVIDIA T4G", "GPU"},
+	"g6":    {"NVIDIA L4", "GPU"},
+	"g6e":   {"NVIDIA L40S", "GPU"},
+	"gr6":   {"NVIDIA L4", "GPU"},
+	"inf1":  {"AWS Inferentia", "Inferentia"},
+	"inf2":  {"AWS Inferentia2", "Inferentia"},
+	"trn1":  {"AWS Trainium", "Trainium"},
+	"trn1n": {"AWS Trainium", "Trainium"},
+	"trn2":  {"AWS Trainium2", "Trainium"},
+	"dl1":   {"Habana Gaudi", "Gaudi"},
+	"dl2q":  {"Qualcomm AI 100", "Qualcomm AI"},
+	"f1":    {"Xilinx Virtex UltraScale+ FPGA", "FPGA"},
+	"f2":    {"AMD Virtex UltraScale+ FPGA", "FPGA"},
+	"vt1":   {"Xilinx U30 FPGA", "FPGA"},
+}
+
+// setAccelerators fills in the accelerator specs of i from the offer attributes, falling back on its family.
+func setAccelerators(i *Instance, attr map[string]string) {
+	i.Specs.Gpu, i.Specs.GpuMem, i.Specs.Accelerator, i.Specs.AcceleratorKind = 0, 0, "", ""
+	for _, a := range acceleratorAttributes {
+		if n, _ := strconv.Atoi(attr[a.Name]); n > 0 {
+			i.Specs.Gpu, i.Specs.AcceleratorKind = n, a.Kind
+			break
+		}
+	}
+	if mem := r_mem.FindStringSubmatch(attr["gpuMemory"]); len(mem) >= 2 {
+		i.Specs.GpuMem, _ = strconv.ParseFloat(mem[1]+mem[2], 64)
+	}
+	if model := strings.TrimSpace(attr["accelerator"]); model != "" && !strings.EqualFold(model, "NA") {
+		i.Specs.Accelerator = model
+	}
+
+	family, known := acceleratorFamilies[instanceFamily(i.Name)]
+	if i.Specs.Accelerator == "" && known && (i.Specs.AcceleratorKind == "" || i.Specs.AcceleratorKind == family.Kind) {
+		i.Specs.Accelerator = family.Model
+	}
+	if i.Specs.AcceleratorKind == "" && i.Specs.Accelerator != "" {
+		i.Specs.AcceleratorKind = acceleratorKind(i.Specs.Accelerator)
+		if known && i.Specs.Accelerator == family.Model {
+			i.Specs.AcceleratorKind = family.Kind
+		}
+	}
+	if i.Specs.Accelerator == "" && i.Specs.AcceleratorKind != "" {
+		i.Specs.Accelerator = i.Specs.AcceleratorKind
+	}
+}
+
+// acceleratorKind is the kind of the accelerator model.
+func acceleratorKind(model string) string {
+	upper := strings.ToUpper(model)
+	for _, k := range acceleratorKinds {
+		if strings.Contains(upper, k.Match) {
+			return k.Kind
+		}
+	}
+	return "GPU"
+}
+
+// acceleratorDesc describes the accelerators of an instance for display i.e. "4 x NVIDIA V100 (64 GiB)".
+func (s InstanceSpecs) acceleratorDesc() string {
+	if s.Accelerator == "" {
+		return ""
+	}
+	desc := s.Accelerator
+	if s.Gpu > 0 {
+		desc = strconv.Itoa(s.Gpu) + " x " + desc
+	}
+	if s.GpuMem > 0 {
+		desc = desc + " (" + strconv.FormatFloat(s.GpuMem, 'f', -1, 64) + " GiB)"
+	}
+	return desc
+}
+
+// matchesAccelerator reports whether the accelerator of s matches the --accelerator option, a case insensitive
+// match against the model or kind i.e. v100, nvidia, inferentia, fpga. "none" only matches instances without one.
+func (s InstanceSpecs) matchesAccelerator(accelerator string) bool {
+	switch accelerator {
+	case "ANY":
+		return true
+	case "NONE":
+		return s.Accelerator == ""
+	}
+	return s.Accelerator != "" &&
+		(strings.Contains(strings.ToUpper(s.Accelerator), accelerator) || strings.Contains(strings.ToUpper(s.AcceleratorKind), accelerator))
+}
@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestSetAccelerators(t *testing.T) {
+	tests := []struct {
+		name  string
+		attr  map[string]string
+		model string
+		kind  string
+		count int
+		mem   float64
+	}{
+		{"p3.8xlarge", map[string]string{"gpu": "4", "gpuMemory": "64 GiB", "accelerator": "NVIDIA V100"}, "NVIDIA V100", "GPU", 4, 64},
+		{"zz9.xlarge", map[string]string{"gpu": "1", "accelerator": "NVIDIA B200"}, "NVIDIA B200", "GPU", 1, 0},
+		{"zz9.xlarge", map[string]string{"inferentia": "2", "accelerator": "AWS Inferentia3"}, "AWS Inferentia3", "Inferentia", 2, 0},
+		{"zz9.xlarge", map[string]string{"accelerator": "AWS Trainium3"}, "AWS Trainium3", "Trainium", 0, 0},
+		{"zz9.xlarge", map[string]string{"fpga": "1"}, "FPGA", "FPGA", 1, 0},
+		// older offers without the model fall back on the family
+		{"p3.2xlarge", map[string]string{"gpu": "1", "gpuMemory": "16 GiB"}, "NVIDIA V100", "GPU", 1, 16},
+		{"inf2.xlarge", map[string]string{}, "AWS Inferentia2", "Inferentia", 0, 0},
+		{"zz9.xlarge", map[string]string{"gpu": "2"}, "GPU", "GPU", 2, 0},
+		{"m5.large", map[string]string{"gpu": "NA", "accelerator": "NA"}, "", "", 0, 0},
+	}
+	for _, tt := range tests {
+		i := Instance{Name: tt.name}
+		setAccelerators(&i, tt.attr)
+		s := i.Specs
+		if s.Accelerator != tt.model || s.AcceleratorKind != tt.kind || s.Gpu != tt.count || s.GpuMem != tt.mem {
+			t.Errorf("%s %v: got %q %q %d %v, want %q %q %d %v", tt.name, tt.attr, s.Accelerator, s.AcceleratorKind, s.Gpu, s.GpuMem, tt.model, tt.kind, tt.count, tt.mem)
+		}
+	}
+}
+
+func TestMatchesAccelerator(t *testing.T) {
+	v100 := InstanceSpecs{Accelerator: "NVIDIA V100", AcceleratorKind: "GPU"}
+	tests := []struct {
+		s    InstanceSpecs
+		opt  string
+		want bool
+	}{
+		{v100, "ANY", true},
+		{v100, "NONE", false},
+		{InstanceSpecs{}, "NONE", true},
+		{v100, "V100", true},
+		{v100, "GPU", true},
+		{v100, "FPGA", false},
+		{InstanceSpecs{}, "GPU", false},
+	}
+	for _, tt := range tests {
+		if got := tt.s.matchesAccelerator(tt.opt); got != tt.want {
+			t.Errorf("%+v %s: got %v", tt.s, tt.opt, got)
+		}
+	}
+}
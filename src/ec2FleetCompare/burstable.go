@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*
+Burstable (T family) instances only sustain a baseline share of each vCPU. Running below it they earn CPU credits, one
+credit being a vCPU at 100% for a minute, and running above it they spend them. In standard mode an instance that runs
+out of credits is held at its baseline, so the vCPUs it offers a workload kept at --cpu-util are its vCPUs scaled
+down by baseline / utilization. In unlimited mode it keeps every vCPU but the credits it spends beyond those it earns
+are charged per vCPU hour, which is added to its price under every pricing model.
+
+The baselines are AWS's published figures by size, the offer file doesn't carry them.
+*/
+
+var burstableBaselines = map[string]map[string]float64{
+	"t2": {"nano": 0.05, "micro": 0.10, "small": 0.20, "medium": 0.20, "large": 0.30, "xlarge": 0.225, "2xlarge": 0.17},
+	"t3": {"nano": 0.05, "micro": 0.10, "small": 0.20, "medium": 0.20, "large": 0.30, "xlarge": 0.40, "2xlarge": 0.40},
+}
+
+// burstableFamilies maps each burstable family onto its table in burstableBaselines and its surplus credit charge
+// per vCPU hour on Linux.
+var burstableFamilies = map[string]struct {
+	baselines string
+	surplus   float64
+}{
+	"t2":  {"t2", 0.05},
+	"t3":  {"t3", 0.05},
+	"t3a": {"t3", 0.05},
+	"t4g": {"t3", 0.04},
+}
+
+// windowsSurplus is the surplus credit charge per vCPU hour of Windows instances.
+const windowsSurplus = 0.096
+
+// setBurstable fills in the baseline and credit earn rate of i if it is a burstable type, its vCPUs must be set.
+func setBurstable(i *Instance) {
+	i.Specs.Burstable, i.Specs.BaselinePerVcpu, i.Specs.CreditsPerHour = false, 0, 0
+	family, size := instanceFamily(i.Name), strings.TrimPrefix(i.Name, instanceFamily(i.Name)+".")
+	f, ok := burstableFamilies[family]
+	if !ok {
+		return
+	}
+	baseline, ok := burstableBaselines[f.baselines][size]
+	if !ok {
+		return
+	}
+	i.Specs.Burstable = true
+	i.Specs.BaselinePerVcpu = baseline
+	i.Specs.CreditsPerHour = baseline * float64(i.Specs.Cpu) * 60
+}
+
+// surplusRate is the charge per vCPU hour of credits spent beyond those earned in unlimited mode.
+func (i Instance) surplusRate() float64 {
+	if strings.EqualFold(i.Specs.Os, "Windows") {
+		return windowsSurplus
+	}
+	return burstableFamilies[instanceFamily(i.Name)].surplus
+}
+
+// sustainedVcpus is the vCPUs i offers a workload at opts.CpuUtil, its baseline share of them for a burstable type
+// in standard mode.
+func (i Instance) sustainedVcpus(opts FilterOptions) float64 {
+	vcpus := float64(i.Specs.Cpu)
+	if !i.Specs.Burstable || opts.CreditMode == "UNLIMITED" || opts.CpuUtil <= 0 {
+		return vcpus
+	}
+	return vcpus * math.Min(1, i.Specs.BaselinePerVcpu/(opts.CpuUtil/100))
+}
+
+// surplusHourly is the unlimited mode charge for one instance of i for an hour at opts.CpuUtil, 0 when it runs
+// within its baseline.
+func (i Instance) surplusHourly(opts FilterOptions) float64 {
+	if !i.Specs.Burstable || opts.CreditMode != "UNLIMITED" {
+		return 0
+	}
+	over := opts.CpuUtil/100 - i.Specs.BaselinePerVcpu
+	if over <= 0 {
+		return 0
+	}
+	return over * float64(i.Specs.Cpu) * i.surplusRate()
+}
+
+// baselineDesc describes the baseline of s for display i.e. "30% (36 cr/h)", empty if it is not burstable.
+func (s InstanceSpecs) baselineDesc() string {
+	if !s.Burstable {
+		return ""
+	}
+	return strconv.FormatFloat(s.BaselinePerVcpu*100, 'f', -1, 64) + "% (" + strconv.FormatFloat(s.CreditsPerHour, 'f', -1, 64) + " cr/h)"
+}
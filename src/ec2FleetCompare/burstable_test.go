@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestBurstableSizing(t *testing.T) {
+	instance := func(name string, os string, cpu int) Instance {
+		i := Instance{Name: name, Specs: InstanceSpecs{Cpu: cpu, Mem: 8, Os: os}}
+		setBurstable(&i)
+		return i
+	}
+	t3 := instance("t3.large", "Linux", 2) // 30% baseline of 2 vCPUs
+	tests := []struct {
+		name      string
+		i         Instance
+		mode      string
+		util      float64
+		sustained float64
+		fleet     int // for 8 vCPUs
+		surplus   float64
+	}{
+		{"standard at full load", t3, "STANDARD", 100, 0.6, 14, 0},
+		{"standard at twice the baseline", t3, "STANDARD", 60, 1, 8, 0},
+		{"standard at the baseline", t3, "STANDARD", 30, 2, 4, 0},
+		{"standard under the baseline", t3, "STANDARD", 10, 2, 4, 0},
+		{"unlimited at full load", t3, "UNLIMITED", 100, 2, 4, 0.7 * 2 * 0.05},
+		{"unlimited over the baseline", t3, "UNLIMITED", 50, 2, 4, 0.2 * 2 * 0.05},
+		{"unlimited at the baseline", t3, "UNLIMITED", 30, 2, 4, 0},
+		{"unlimited on windows", instance("t3.large", "Windows", 2), "UNLIMITED", 100, 2, 4, 0.7 * 2 * windowsSurplus},
+		{"not burstable", instance("m5.large", "Linux", 2), "STANDARD", 100, 2, 4, 0},
+		{"not burstable unlimited", instance("m5.large", "Linux", 2), "UNLIMITED", 100, 2, 4, 0},
+	}
+	for _, tt := range tests {
+		opts := testFilterOptions()
+		opts.CreditMode = tt.mode
+		opts.CpuUtil = tt.util
+		opts.MinFleetCPU = 8
+		opts.MinFleetMem = 0
+		fleet, binding, _ := fleetSize(tt.i, opts)
+		if got := tt.i.sustainedVcpus(opts); !nearly(got, tt.sustained) || fleet != tt.fleet || binding != "VCPU" {
+			t.Errorf("%s: got %v vCPUs, %d instances on %s, want %v, %d", tt.name, got, fleet, binding, tt.sustained, tt.fleet)
+		}
+		if got := tt.i.surplusHourly(opts); !nearly(got, tt.surplus) {
+			t.Errorf("%s: got a surplus of %v an hour, want %v", tt.name, got, tt.surplus)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*
+Every instance carries its generation (currentGeneration, "Yes" or "No") and the family AWS files it under
+(instanceFamily, i.e. "General purpose", "Compute optimized", "Memory optimized", "Storage optimized",
+"GPU instance"), which is called its category here so it isn't mistaken for the m5 or c5 of its name.
+*/
+
+// setCategory fills in the generation and category of i from the offer attributes.
+func setCategory(i *Instance, attr map[string]string) {
+	i.Specs.CurrentGeneration = attr["currentGeneration"] == "Yes"
+	i.Specs.Category = attr["instanceFamily"]
+}
+
+// matchesCategory reports whether s is in one of the --category options, a comma separated list matched partially
+// i.e. compute, memory,storage.
+func (s InstanceSpecs) matchesCategory(categories string) bool {
+	if categories == "" || categories == "ANY" {
+		return true
+	}
+	for _, c := range strings.Split(categories, ",") {
+		c = strings.TrimSpace(c)
+		if c != "" && strings.Contains(strings.ToUpper(s.Category), c) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludePatterns compiles the --exclude option, a comma separated list of instance type patterns matched the same
+// way as --instance.
+func excludePatterns(exclude string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, e := range strings.Split(exclude, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			p, err := regexp.Compile(`(?i).*` + e + `.*`)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid --exclude pattern %q: %v", e, err)
+			}
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns, nil
+}
+
+// excluded reports whether the instance type name matches any of patterns.
+func excluded(patterns []*regexp.Regexp, name string) bool {
+	for _, p := range patterns {
+		if p.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
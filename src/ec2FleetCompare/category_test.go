@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestExcludePatterns(t *testing.T) {
+	tests := []struct {
+		exclude string
+		name    string
+		want    bool
+		ok      bool
+	}{
+		{"t2, m4", "t2.micro", true, true},
+		{"t2, m4", "M4.large", true, true},
+		{"t2, m4", "m5.large", false, true},
+		{"", "m5.large", false, true},
+		{`^t\d\.`, "t3.nano", true, true},
+		{"t2.(", "t2.micro", false, false},
+		{"m5, [", "m5.large", false, false},
+	}
+	for _, tt := range tests {
+		patterns, err := excludePatterns(tt.exclude)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: got error %v", tt.exclude, err)
+			continue
+		}
+		if got := excluded(patterns, tt.name); got != tt.want {
+			t.Errorf("%q on %s: got %v", tt.exclude, tt.name, got)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+)
+
+/*
+Instances of "Host" tenancy are listed in the offer file with a zero price, what is actually paid for is the
+"Dedicated Host" product of their family (m5, c5 ...). Each such instance is joined to its host so it can be priced
+per host, and the number of instances of its size that fit on a host gives the cost per instance once the host is
+fully packed.
+*/
+
+// DedicatedHost is the physical host Host tenancy instances are placed on, it is paid for as a whole.
+type DedicatedHost struct {
+	Sku              string
+	Family           string // instance family the host runs i.e. m5
+	Vcpu             int
+	UsageType        string
+	Operation        string
+	DemandPrice      float64
+	Reservations     []Reservation
+	SavingsPlanPrice float64 // not cached, see Instance.SavingsPlanPrice
+	LicensePrice     float64 // per instance charge on top of the host, for licensed OS and software
+	InstancesPerHost int     // how many instances of the joined size fit on one host
+}
+
+// hostsFor is the number of hosts needed to place numInstances.
+func (h DedicatedHost) hostsFor(numInstances int) int {
+	return (numInstances + h.InstancesPerHost - 1) / h.InstancesPerHost
+}
+
+func instanceFamily(name string) string {
+	return strings.SplitN(name, ".", 2)[0]
+}
+
+// combineHosts joins every Host tenancy instance to the host of its family in its region. Instances whose host is
+// missing, or which are too big to fit it, cannot be priced and are dropped.
+func combineHosts(instances map[string]*Instance, hosts map[string]bool) {
+	byFamily := make(map[string]*Instance)
+	for sku := range hosts {
+		h := instances[sku]
+		byFamily[h.RegionCode+"|"+h.Name] = h
+		delete(instances, sku)
+	}
+
+	for sku, i := range instances {
+		if i.Tenancy != "Host" {
+			continue
+		}
+		h, ok := byFamily[i.RegionCode+"|"+instanceFamily(i.Name)]
+		if !ok || i.Specs.Cpu < 1 || h.Specs.Cpu < i.Specs.Cpu {
+			delete(instances, sku)
+			continue
+		}
+		i.Host = &DedicatedHost{
+			Sku:              h.Sku,
+			Family:           h.Name,
+			Vcpu:             h.Specs.Cpu,
+			UsageType:        h.UsageType,
+			Operation:        h.Operation,
+			DemandPrice:      h.DemandPrice,
+			Reservations:     h.Reservations,
+			InstancesPerHost: h.Specs.Cpu / i.Specs.Cpu,
+			LicensePrice:     i.DemandPrice,
+		}
+		// the instance SKU itself only charges for licenses, on a full host each instance also costs its share of the host
+		i.DemandPrice = h.DemandPrice/float64(i.Host.InstancesPerHost) + i.Host.LicensePrice
+	}
+}
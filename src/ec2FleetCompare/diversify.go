@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+)
+
+/*
+Diversification spreads a spot fleet over several capacity pools, an instance type in an availability zone, so losing
+one pool to a capacity shortage only takes part of the fleet with it. Each filtered instance sold as spot is a pool
+per zone with --spot-history zone prices, otherwise a single pool for its region. Pools are weighted by vCPUs or GiB
+of memory (--weight), making them interchangeable units of capacity, and compared by their spot price per unit.
+
+Every pool within --tolerance % of the cheapest per unit is used, up to --max-pools of the cheapest, and there must
+be at least --diversify N of them. The --fleetcpu or --fleetmem target, which has to be given, is split evenly over
+them, each pool rounding its share up to whole instances. The blended cost is what that fleet costs, the worst case
+what it costs once the cheapest pool is lost and the capacity it held is made up by the others, again split evenly
+and rounded up. Only the weighted resource sizes the fleet, the other fleet targets are not looked at, but the
+instances of all pools together have to fall within --min and --max. A bare --max-monthly or --max-hourly is a spot
+ceiling here.
+*/
+
+// divPool is one spot capacity pool.
+type divPool struct {
+	filtered Ec2Filtered
+	zone     string  // availability zone, the region code without zone prices
+	price    float64 // spot price per instance hour
+	units    float64 // vCPUs or GiB of memory per instance
+}
+
+func (p divPool) unitPrice() float64 {
+	return p.price / p.units
+}
+
+// divWeights maps the --weight options onto the units an instance counts as and the fleet target in them.
+var divWeights = map[string]struct {
+	units  func(i Instance, opts FilterOptions) float64
+	target func(opts FilterOptions) float64
+	flag   string // the fleet target option, which must be set
+}{
+	"vcpu": {func(i Instance, o FilterOptions) float64 { return i.sustainedVcpus(o) }, func(o FilterOptions) float64 { return float64(o.MinFleetCPU) }, "fleetcpu"},
+	"mem":  {func(i Instance, o FilterOptions) float64 { return i.Specs.Mem }, func(o FilterOptions) float64 { return float64(o.MinFleetMem) }, "fleetmem"},
+}
+
+// divPools lists the spot capacity pools of the filtered instances, cheapest per unit first.
+func divPools(ec2 Ec2, opts FilterOptions, weight string) []divPool {
+	units := divWeights[weight].units
+	var pools []divPool
+	for _, f := range doFilter(ec2, withoutFleetTargets(opts)) {
+		hasPrice := f.Instance.SpotPrice > 0 && f.Instance.SpotPrice != 999999.9
+		if f.Instance.Host != nil || (!hasPrice && len(f.Instance.SpotZones) == 0) {
+			continue
+		}
+		u := units(f.Instance, opts)
+		if u <= 0 {
+			continue
+		}
+		// burstable instances in unlimited mode pay for their surplus credits whichever pool they run in
+		surplus := f.Instance.surplusHourly(opts)
+		if len(f.Instance.SpotZones) == 0 {
+			pools = append(pools, divPool{f, f.Instance.RegionCode, f.Instance.SpotPrice + surplus, u})
+			continue
+		}
+		for _, z := range f.Instance.SpotZones {
+			pools = append(pools, divPool{f, z.Zone, z.Price + surplus, u})
+		}
+	}
+	sort.SliceStable(pools, func(a, b int) bool {
+		if pools[a].unitPrice() != pools[b].unitPrice() {
+			return pools[a].unitPrice() < pools[b].unitPrice()
+		}
+		if pools[a].filtered.Instance.Name != pools[b].filtered.Instance.Name {
+			return pools[a].filtered.Instance.Name < pools[b].filtered.Instance.Name
+		}
+		return pools[a].zone < pools[b].zone
+	})
+	return pools
+}
+
+// divAllocate splits target units evenly over pools, returning the instances in each and the hourly cost.
+func divAllocate(pools []divPool, target float64) ([]int, float64) {
+	counts := make([]int, len(pools))
+	var hourly float64
+	for n, p := range pools {
+		counts[n] = int(math.Ceil(target / float64(len(pools)) / p.units))
+		if counts[n] < 1 {
+			counts[n] = 1
+		}
+		hourly += float64(counts[n]) * p.price
+	}
+	return counts, hourly
+}
+
+func doDiversify(ec2 Ec2, opts FilterOptions, minPools int, maxPools int, tolerance float64, weight string) error {
+	if minPools < 1 {
+		return fmt.Errorf("diversify must be at least 1 pool, got %d", minPools)
+	}
+	if maxPools != 0 && maxPools < minPools {
+		return fmt.Errorf("max-pools must be 0 (no limit) or at least diversify's %d, got %d", minPools, maxPools)
+	}
+	if tolerance < 0 {
+		return fmt.Errorf("tolerance must not be negative, got %v", tolerance)
+	}
+	if _, ok := divWeights[weight]; !ok {
+		return fmt.Errorf("Unknown weight %q, options: vcpu, mem", weight)
+	}
+	target := divWeights[weight].target(opts)
+	if target <= 0 {
+		return fmt.Errorf("Diversifying by %s needs a fleet target for it, --fleetcpu or --fleetmem", weight)
+	}
+
+	all := divPools(ec2, opts, weight)
+	if len(all) == 0 {
+		return fmt.Errorf("No instances match the filters with a spot price")
+	}
+	ceiling := all[0].unitPrice() * (1 + tolerance/100)
+	eligible := 0
+	for _, p := range all {
+		if p.unitPrice() > ceiling {
+			break
+		}
+		eligible++
+	}
+	if eligible < minPools {
+		return fmt.Errorf("Only %d spot pools are within %v%% of the cheapest per %s, %d asked for: raise --tolerance or loosen the filters", eligible, tolerance, weight, minPools)
+	}
+
+	used := eligible
+	if maxPools > 0 && used > maxPools {
+		used = maxPools
+	}
+	pools := all[:used]
+	counts, hourly := divAllocate(pools, target)
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	if opts.MaxInstanceCount > 0 && total > opts.MaxInstanceCount {
+		return fmt.Errorf("The diversified fleet takes %d instances, over the --max of %d", total, opts.MaxInstanceCount)
+	}
+	if total < opts.MinInstanceCount {
+		return fmt.Errorf("The diversified fleet takes %d instances, under the --min of %d", total, opts.MinInstanceCount)
+	}
+	monthly := hourly * 24 * 30
+	if limit, ok := opts.MaxMonthly["spot"]; ok && monthly > limit {
+		return fmt.Errorf("The diversified fleet costs $%s/month, over the --max-monthly of $%s", humanize.Comma(int64(monthly)), humanize.Comma(int64(limit)))
+	}
+
+	unitName := map[string]string{"vcpu": "VCPU", "mem": "GiB"}[weight]
+	var data [][]string
+	var instances int
+	var units float64
+	for n, p := range pools {
+		instances += counts[n]
+		units += float64(counts[n]) * p.units
+		data = append(data, []string{
+			strconv.Itoa(counts[n]),
+			p.filtered.Instance.Name,
+			p.zone,
+			formatResource(p.units),
+			"$" + strconv.FormatFloat(p.price, 'f', 4, 64),
+			"$" + strconv.FormatFloat(p.unitPrice(), 'f', 4, 64),
+			p.filtered.Instance.interruptionDesc(),
+			"$" + humanize.Comma(int64(float64(counts[n])*p.price*24*30)),
+		})
+	}
+
+	header := []string{"# Inst", "Type", "Pool", unitName + " ea", "Spot/Hour ea", "$/" + unitName + "-Hour", "Interruption", "Spot/Mon"}
+	footer := []string{strconv.Itoa(instances), "Blended", strconv.Itoa(len(pools)) + " pools", formatResource(units), "", "$" + strconv.FormatFloat(hourly/units, 'f', 4, 64), "", "$" + humanize.Comma(int64(monthly))}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(header)
+	table.SetFooter(footer)
+	table.SetBorder(true)
+	table.SetAutoWrapText(false)
+	table.AppendBulk(data)
+	table.Render()
+
+	if len(pools) > 1 {
+		_, replacement := divAllocate(pools[1:], float64(counts[0])*pools[0].units)
+		worst := hourly - float64(counts[0])*pools[0].price + replacement
+		fmt.Printf("Worst case, %s in %s lost: $%s/month (%+.1f%%) made up by the other %d pools\n",
+			pools[0].filtered.Instance.Name, pools[0].zone, humanize.Comma(int64(worst*24*30)),
+			(worst-hourly)/hourly*100, len(pools)-1)
+	} else {
+		fmt.Println("Worst case: a single pool, losing it loses the whole fleet")
+	}
+	if eligible > used {
+		var more []string
+		for _, p := range all[used:eligible] {
+			more = append(more, p.filtered.Instance.Name+" in "+p.zone)
+		}
+		listed := more
+		if len(listed) > 10 {
+			listed = append(listed[:10:10], "...")
+		}
+		fmt.Printf("%d more pools within %v%% left out by --max-pools: %s\n", len(more), tolerance, strings.Join(listed, ", "))
+	}
+	return nil
+}
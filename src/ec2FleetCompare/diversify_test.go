@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDivAllocate(t *testing.T) {
+	pool := func(price, units float64) divPool { return divPool{price: price, units: units} }
+	tests := []struct {
+		name   string
+		pools  []divPool
+		target float64
+		counts []int
+		hourly float64
+	}{
+		{"even split", []divPool{pool(0.1, 4), pool(0.2, 8)}, 64, []int{8, 4}, 1.6},
+		{"shares round up", []divPool{pool(0.1, 4), pool(0.2, 8), pool(0.4, 16)}, 64, []int{6, 3, 2}, 2},
+		{"at least one each", []divPool{pool(0.1, 4), pool(1, 96)}, 8, []int{1, 1}, 1.1},
+		{"single pool", []divPool{pool(0.05, 2)}, 9, []int{5}, 0.25},
+	}
+	for _, tt := range tests {
+		counts, hourly := divAllocate(tt.pools, tt.target)
+		if !reflect.DeepEqual(counts, tt.counts) || !nearly(hourly, tt.hourly) {
+			t.Errorf("%s: got %v %v, want %v %v", tt.name, counts, hourly, tt.counts, tt.hourly)
+		}
+	}
+}
+
+func TestDoDiversifyInstanceCount(t *testing.T) {
+	var ec2 Ec2
+	if err := parseOffer(strings.NewReader(testOffer(false)), &ec2, newOfferFilter("us-east-1"), 1); err != nil {
+		t.Fatal(err)
+	}
+	ec2.Instance[0].SpotPrice = 0.035 // m5.large on Linux, the only spot pool
+	tests := []struct {
+		name string
+		min  int
+		max  int
+		ok   bool
+	}{
+		{"within", 1, 4, true},
+		{"over --max", 1, 3, false},
+		{"under --min", 5, 0, false},
+	}
+	for _, tt := range tests {
+		opts := testFilterOptions()
+		opts.MinFleetCPU = 8 // four m5.large
+		opts.MinInstanceCount = tt.min
+		opts.MaxInstanceCount = tt.max
+		if err := doDiversify(ec2, opts, 1, 0, 0, "vcpu"); (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v", tt.name, err)
+		}
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"github.com/olekukonko/tablewriter"
 	"github.com/dustin/go-humanize"
 	"time"
-	"net/http"
 	"os"
 	"strconv"
 	"encoding/json"
@@ -16,63 +15,48 @@ import (
 	"io/ioutil"
 	"strings"
 	"sort"
+	"runtime"
 	// "github.com/davecgh/go-spew/spew"
 )
 
 var cacheDir = ".ec2FleetCompare"
+
+// cacheFormat is bumped whenever the layout of the cached structures changes, so older caches are refetched rather than half read
+var cacheFormat = "14"
 var ec2PricesURL string = "https://pricing.us-east-1.amazonaws.com/offers/v1.0/aws/AmazonEC2/current/index.json";
 var ec2SpotPricesURL string = "https://spot-price.s3.amazonaws.com/spot.js"
 
-// var ec2PricesURL string = "http://localhost:1313/ec2_demand_prices.json"
-// var ec2SpotPricesURL string = "http://localhost:1313/spot.js"
-
-
-var ec2RegionMap = map[string]string{
-	"AWS GovCloud (US)": 					"gov-west-1",
-	"Asia Pacific (Seoul)": 			"ap-northeast-2",
-	"Asia Pacific (Singapore)": 	"ap-southeast-1",
-	"Asia Pacific (Sydney)": 			"ap-southeast-2",
-	"Asia Pacific (Tokyo)":				"ap-northeast-1",
-	"EU (Frankfurt)": 						"eu-central-1",
-	"EU (Ireland)": 							"eu-west-1",
-	"South America (Sao Paulo)": 	"sa-east-1",
-	"US East (N. Virginia)": 			"us-east-1",
-	"US West (N. California)": 		"us-west-1",
-	"US West (Oregon)": 					"us-west-2",
-}
-
-var ec2RSpotegionMap = map[string]string{
-	"AWS GovCloud (US)": 	"gov-west-1",
-	"ap-northeast-2": 		"ap-northeast-2",
-	"apac-sin": 					"ap-southeast-1",
-	"apac-syd": 					"ap-southeast-2",
-	"apac-tokyo":					"ap-northeast-1",
-	"eu-central-1": 			"eu-central-1",
-	"eu-ireland": 				"eu-west-1",
-	"sa-east-1": 					"sa-east-1",
-	"us-east": 						"us-east-1",
-	"us-west": 						"us-west-1",
-	"us-west-2": 					"us-west-2",
-}
-
-var networkMap = map[string]int{
-	"any": 	4,
-	"low": 	4,
-	"med": 	3,
-	"high": 2,
-	"gbit": 1,
-}
 
 type InstanceSpecs struct {
 	Mem         float64
 	Cpu         int
 	Os					string
+	License			string // License included, No License required or Bring your own license
+	Software		string // pre-installed software i.e. SQL Std, NA for none
 	CpuClock		string
-	DiskSize		int
-	DiskType		string
-	NetworkType int
+	ClockGHz		float64 // 0 if CpuClock has no figure
+	Ecu					float64 // 0 for Variable (burstable) or unrated
+	Processor		string // i.e. Intel Xeon Platinum 8175, AWS Graviton2, see processor.go
+	Vendor			string // Intel, AMD, AWS, Apple
+	Arch				string // x86_64, arm64
+	CpuFeatures	[]string // normalised processorFeatures i.e. AVX512, TURBO
+	DiskSize		int // GB across all disks
+	DiskCount		int
+	DiskSizeEach	float64 // GB per disk
+	DiskType		string // NVMe SSD, SSD, HDD or EBS (no instance store), see storage.go
 	NetworkDesc	string
+	NetworkBaselineGbps	float64 // estimated for "Up to" ratings, see network.go
+	NetworkBurstGbps		float64
+	Gpu					int
+	GpuMem				float64 // GiB across all GPUs
+	Accelerator		string // model i.e. NVIDIA V100, AWS Inferentia, see accelerators.go
+	AcceleratorKind	string // GPU, Inferentia, Trainium, FPGA ...
 	Description string
+	CurrentGeneration	bool
+	Category		string // instanceFamily i.e. General purpose, Compute optimized, see category.go
+	Burstable		bool // T family, see burstable.go
+	BaselinePerVcpu	float64 // share of each vCPU sustained, 0.3 for 30%
+	CreditsPerHour	float64 // CPU credits earned an hour
 }
 
 type Instance struct {
@@ -80,31 +64,97 @@ type Instance struct {
 	Name										string
 	RegionName							string
 	RegionCode							string
+	UsageType								string // i.e. USE1-BoxUsage:c5.large, region + tenancy + instance type
+	Operation								string // i.e. RunInstances:0002, identifies the OS
+	Tenancy									string // Shared, Dedicated or Host
+	Host										*DedicatedHost // set for Host tenancy
 	Specs 									InstanceSpecs
 	DemandPrice 						float64
-	Reserve1YPartialPrice 	float64
-	Reserve1YPartialUpfront float64
-	Reserve1YZeroPrice 			float64
-	Reserve1YFullUpfront 		float64
-	Reserve3YPartialPrice 	float64
-	Reserve3YPartialUpfront float64
-	Reserve3YFullUpfront 		float64
+	Reservations 						[]Reservation
 	SpotPrice 							float64
+	Interruption						*SpotInterruption // Spot Instance Advisor band, nil if unknown, not cached
+	SpotHistory							*SpotStats // over --history-window, nil without --spot-history, not cached
+	SpotZones								[]ZonePrice // latest price by availability zone, cheapest first, see zones.go
+	SavingsPlanPrice				float64 // effective hourly rate of the --sp plan, not cached
+	LicensePremium					float64 // hourly cost over the base OS price, see computeLicensePremiums
 }
 
 type Ec2 struct {
 	Instance []Instance
+	Regions  map[string]Region // by region code, see regions.go
 }
 
 type Ec2Filtered struct {
 	NumberInstances		int
+	Binding						string // the fleet resource that decided NumberInstances, see fleetSize
+	Placement					string // availability zones the spot fleet is spread across with --azs
 	SortPrice					float64
 	TotalPriceDemand	float64
 	TotalPriceRI			float64
 	TotalPriceSpot		float64
+	TotalPriceSP			float64
+	RIUpfront					float64 // one-off payment for the whole fleet
+	RIRecurring				float64 // recurring monthly cost of the whole fleet
+	RIEffectiveHourly	float64 // upfront amortized over the term plus recurring, per instance hour
+	SurplusMonthly		float64 // unlimited mode surplus credit charges of the whole fleet, in every Total
+	MemPerVcpu				float64 // derived metrics, see metrics.go
+	VcpuHour					float64
+	GiBHour						float64
+	EcuHour						float64
+	GHzCoreHour				float64
 	Instance					Instance
 }
 
+// FilterOptions holds everything doFilter selects and prices instances by, most of it straight from the command line.
+type FilterOptions struct {
+	Region						string
+	Geography					string
+	Location					string
+	InstanceCount			int
+	MinInstanceCount	int
+	MaxInstanceCount	int // 0 for no limit, as for every Max below
+	MinCPU						int
+	MaxCPU						int
+	MinFleetCPU				int
+	CpuUtil						float64 // expected average CPU utilization in %, see burstable.go
+	CreditMode				string // STANDARD or UNLIMITED, how burstable instances run past their baseline
+	MinMem						int
+	MaxMem						int
+	MinFleetMem				int
+	MinFleetDisk			int
+	MinFleetNetwork		float64
+	MinFleetGPU				int
+	MinDisk						int
+	MaxDisk						int
+	MaxHourly					PriceLimits // per instance, see pricing.go
+	MaxMonthly				PriceLimits // whole fleet
+	MaxInterruption		float64 // spot interruption band in %, see spotAdvisor.go
+	SpotZones					int // availability zones to spread a spot fleet across, 0 to price it by region
+	Where							*WhereExpr // --where, nil for none
+	MinGPU						int
+	MinGPUMem					int
+	Accelerator				string
+	Arch							string
+	Vendor						string
+	CpuFeatures				string
+	DiskType					string
+	MinNetwork				float64 // Gbps
+	NetworkBasis			string // BASELINE or BURST, which rate MinNetwork is compared against
+	OperatingSystem		string
+	InstanceType			string
+	Exclude						string // comma separated instance type patterns
+	CurrentOnly				bool
+	Category					string
+	Tenancy						string
+	License						string
+	Software					string
+	RIType						string
+	SPType						string
+	Sort							string
+	MetricModel				string // pricing model the metrics are computed on
+	ShowMetrics				bool
+}
+
 type FilteredResults []Ec2Filtered
 
 func (slice FilteredResults) Len() int {
@@ -126,15 +176,21 @@ func printError(s string) {
 	fmt.Println("********************************************************************************\n\n")
 }
 
-func getJson(url string, target interface{}, jsonp bool) error {
-	resp, err := http.Get(url)
+func printWarning(s string) {
+	fmt.Println("**************************** WARNING *******************************************")
+	fmt.Printf("WARNING: %s\n", s)
+	fmt.Print("********************************************************************************\n\n")
+}
+
+func getJson(src PriceSource, location string, target interface{}, jsonp bool) error {
+	body, err := src.Open(location)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	defer body.Close()
 
 	if jsonp {
-		body, err := ioutil.ReadAll(resp.Body)
+		body, err := ioutil.ReadAll(body)
 		if err != nil {
 			return err
 		}
@@ -146,159 +202,14 @@ func getJson(url string, target interface{}, jsonp bool) error {
 
 		return json.Unmarshal(jsonBytes[1], target)
 	} else {
-		return json.NewDecoder(resp.Body).Decode(target)
+		return json.NewDecoder(body).Decode(target)
 	}
 }
 
-func downloadDemandPrices (ec2 *Ec2) error {
-	var data map[string]interface{}
-	if err := getJson(ec2PricesURL, &data, false); err != nil {
-		return err
-	}
-	serverTypes, _ 			:= data["products"].(map[string]interface{})
-
-	r_mem 	:= regexp.MustCompile(`(\d+)(?:(\.\d+))*\s+GiB`)
-	r_disk 	:= regexp.MustCompile(`(\d)\s+x\s+(\d+)(?:\s+(SSD|HDD))*`)
-
-	for server, serverSpecs := range serverTypes {
-		serverSpecs, ok := serverSpecs.(map[string]interface{})
-		if !ok {
-			return errors.New("Type assertion failed on Server Specs")
-		}
-
-		// make sure this is actually a EC2 server JSON object
-		family, ok := serverSpecs["productFamily"].(string)
-		if !ok || family != "Compute Instance" {
-			continue
-		}
-
-		serverAttributes, ok := serverSpecs["attributes"].(map[string]interface{})
-		if ! ok {
-			return errors.New("Type assertion failed on attributes")
-		}
-
-		// just process all but unknown OS
-		os, ok := serverAttributes["operatingSystem"].(string)
-		if !ok || os == "NA"  {
-			continue
-		}
-
-		// drop anything thats bring your own license
-		license, ok := serverAttributes["licenseModel"].(string)
-		if !ok || (license == "Bring your own license") {
-			continue
-		}
-
-		// drop anything having pre-installed software
-		software, ok := serverAttributes["preInstalledSw"].(string)
-		if !ok || (software != "" && software != "NA") {
-			continue
-		}
-
-		// drop anything that is not shared hosting
-		tenancy, ok := serverAttributes["tenancy"].(string)
-		if !ok || (tenancy != "Shared") {
-			continue
-		}
-
-		mem := r_mem.FindStringSubmatch(serverAttributes["memory"].(string))
-
-		var i Instance
-
-		i.Name, ok = serverAttributes["instanceType"].(string)
-		i.RegionName, ok = serverAttributes["location"].(string)
-		i.RegionCode = ec2RegionMap[i.RegionName]
-		i.Sku = server
-		i.Specs.Cpu, _  = strconv.Atoi(serverAttributes["vcpu"].(string))
-		i.Specs.CpuClock, ok = serverAttributes["clockSpeed"].(string)
-		i.Specs.NetworkDesc, ok = serverAttributes["networkPerformance"].(string)
-		i.Specs.Os = os
-
-
-		if (len(mem) >= 2) {
-			i.Specs.Mem, _ = strconv.ParseFloat(mem[1] + mem[2], 64)
-		} else {
-			i.Specs.Mem = 0 // basically could not match memory
-		}
-
-		// set networkType code based on networkDesc
-		switch i.Specs.NetworkDesc {
-		case `10 Gigabit`:
-			i.Specs.NetworkType = 1
-		case `High`:
-			i.Specs.NetworkType = 2
-		case `Moderate`:
-			i.Specs.NetworkType = 3
-		default:
-			i.Specs.NetworkType = 4
-		}
-
-		if serverAttributes["storage"].(string) == "EBS only" {
-			i.Specs.DiskSize = 0
-			i.Specs.DiskType ="EBS"
-		} else {
-			disk := r_disk.FindStringSubmatch(serverAttributes["storage"].(string))
-			if len(disk) == 4 {
-				diskSize, _ := strconv.ParseInt(disk[1], 10, 32)
-				numDisks, _ := strconv.ParseInt(disk[2], 10, 32)
-				i.Specs.DiskSize = int(diskSize * numDisks)
-				if len(disk[3]) < 1 {
-					i.Specs.DiskType = "HDD"
-				} else {
-					i.Specs.DiskType = disk[3]
-				}
-			}
-		}
-
-		// The price JSON structure is somewhat crazy and has a bunch of hardcoded ID's the structure below
-		// is used to capture the required fields, and their hardcoded codes - which is then looped through to find what we need.
-
-		prices := [][]string{
-			{"demandPrice"									, "OnDemand", ".JRTCKXETXF", ".JRTCKXETXF.6YS6EN2CT7", ""},
-			{"reservedPartial1Year"					, "Reserved", ".HU7G6KETJZ", ".HU7G6KETJZ.6YS6EN2CT7", ""},
-			{"reservedPartial1YearUpfront"	, "Reserved", ".HU7G6KETJZ", ".HU7G6KETJZ.2TG2D8R56U", ""},
-			{"reservedZero1Year"						, "Reserved", ".4NA7Y494T4", ".4NA7Y494T4.6YS6EN2CT7", ""},
-			{"reservedFull1YearUpfront"			, "Reserved", ".6QCMYABX3D", ".6QCMYABX3D.2TG2D8R56U", ""},
-			{"reservedPartial3Year"					, "Reserved", ".38NPMPTW36", ".38NPMPTW36.6YS6EN2CT7", ""},
-			{"reservedPartial3YearUpfront"	, "Reserved", ".38NPMPTW36", ".38NPMPTW36.2TG2D8R56U", ""},
-			{"reservedPFull3YearUpFront"		, "Reserved", ".NQ3QZPMQV9", ".NQ3QZPMQV9.2TG2D8R56U", ""},
-		}
-
-		for row := range prices {
-			object, ok := data["terms"].(map[string]interface{})[prices[row][1]].(map[string]interface{})[i.Sku].(map[string]interface{})
-			if ok {
-				price, ok := object[i.Sku + prices[row][2]].(map[string]interface{})
-				if ok {
-					price, ok := price["priceDimensions"].(map[string]interface{})[i.Sku + prices[row][3]].(map[string]interface{})
-					if ok {
-						prices[row][4], _ = price["pricePerUnit"].(map[string]interface{})["USD"].(string)
-					}
-				}
-			}
-		}
-
-		i.DemandPrice, _ 							= strconv.ParseFloat(prices[0][4],64)
-		i.Reserve1YPartialPrice, _ 		= strconv.ParseFloat(prices[1][4],64)
-		i.Reserve1YPartialUpfront, _ 	= strconv.ParseFloat(prices[2][4],64)
-		i.Reserve1YZeroPrice, _  			= strconv.ParseFloat(prices[3][4],64)
-		i.Reserve1YFullUpfront, _ 		= strconv.ParseFloat(prices[4][4],64)
-		i.Reserve3YPartialPrice, _		= strconv.ParseFloat(prices[5][4],64)
-		i.Reserve3YPartialUpfront,_		= strconv.ParseFloat(prices[6][4],64)
-		i.Reserve3YFullUpfront,_			= strconv.ParseFloat(prices[7][4],64)
-
-
-		// set fake spot price which should get over-set
-		i.SpotPrice = 999999.9
-
-		ec2.Instance = append(ec2.Instance, i)
-	}
-	return nil
-}
-
-func downloadSpotPrices (ec2 *Ec2) error {
+func downloadSpotPrices (src PriceSource, ec2 *Ec2) error {
 
 	var data map[string]interface{}
-	if err := getJson(ec2SpotPricesURL, &data, true); err != nil {
+	if err := getJson(src, ec2SpotPricesURL, &data, true); err != nil {
 		return err
 	}
 	regions, _ := data["config"].(map[string]interface{})["regions"].([]interface {})
@@ -314,7 +225,7 @@ func downloadSpotPrices (ec2 *Ec2) error {
 					 os, _ := instance["valueColumns"].([]interface {})[osType].(map[string]interface{})
 					 var i Instance
 					 i.Name, _ 				= instance["size"].(string)
-					 i.RegionCode   	= ec2RSpotegionMap[regionCode]
+					 i.RegionCode   	= spotRegionCode(regionCode)
 					 // Convert Spot OS Names to ones that match the Demand Names!!!
 					 switch os["name"].(string) {
 					 	case "linux":
@@ -332,24 +243,34 @@ func downloadSpotPrices (ec2 *Ec2) error {
 	return nil
 }
 
+// spotEligible is whether the instance is sold as spot at all: shared tenancy, no pre-installed software and not BYOL.
+func (i Instance) spotEligible() bool {
+	return i.Tenancy == "Shared" && i.Specs.Software == "NA" && i.Specs.License != byolLicense
+}
+
 func combinePrices (demand *Ec2, spot *Ec2) error {
 
+	// spot prices by region|os|type, the first one listed wins
+	prices := make(map[string]float64, len(spot.Instance))
+	for s := range spot.Instance {
+		key := spotHistoryKey(spot.Instance[s].RegionCode, spot.Instance[s].Specs.Os, spot.Instance[s].Name)
+		if _, ok := prices[key]; !ok && spot.Instance[s].SpotPrice > 0 {
+			prices[key] = spot.Instance[s].SpotPrice
+		}
+	}
 	for d := range demand.Instance {
-		for s := range spot.Instance {
-			if demand.Instance[d].Specs.Os == spot.Instance[s].Specs.Os 		&&
-				 demand.Instance[d].RegionCode == spot.Instance[s].RegionCode &&
-				 demand.Instance[d].Name == spot.Instance[s].Name 						&&
-				 spot.Instance[s].SpotPrice > 0  {
-				 demand.Instance[d].SpotPrice = spot.Instance[s].SpotPrice
-				 break
-			 }
+		if !demand.Instance[d].spotEligible() {
+			continue
+		}
+		if price, ok := prices[spotHistoryKey(demand.Instance[d].RegionCode, demand.Instance[d].Specs.Os, demand.Instance[d].Name)]; ok {
+			demand.Instance[d].SpotPrice = price
 		}
 	}
 	return nil
 }
 
 
-func readCache(s *Ec2, cacheFile string, maxCache time.Duration, skipDownload bool) error {
+func readCache(s interface{}, cacheFile string, maxCache time.Duration, skipDownload bool) error {
 
 	// get homedir
 	home, err := homedir.Dir()
@@ -365,7 +286,7 @@ func readCache(s *Ec2, cacheFile string, maxCache time.Duration, skipDownload bo
 	}
 
 	// get cache files metaData
-	metaCache, err := os.Stat(home + "/" + cacheDir + "/" + cacheFile)
+	metaCache, err := os.Stat(cachePath(home, cacheFile))
 	if err != nil {
 		return errors.New("Cache Doesnt exist")
 	}
@@ -375,7 +296,7 @@ func readCache(s *Ec2, cacheFile string, maxCache time.Duration, skipDownload bo
 	}
 
 	// our cache file is present and not to old!
-	b, err := ioutil.ReadFile(home + "/" + cacheDir + "/" + cacheFile)
+	b, err := ioutil.ReadFile(cachePath(home, cacheFile))
 	if err != nil {
 		return err
 	}
@@ -387,6 +308,10 @@ func readCache(s *Ec2, cacheFile string, maxCache time.Duration, skipDownload bo
 	return nil
 }
 
+func cachePath(home string, cacheFile string) string {
+	return home + "/" + cacheDir + "/" + strings.TrimSuffix(cacheFile, ".cache") + ".v" + cacheFormat + ".cache"
+}
+
 func writeCache (b []byte, cacheFile string) error {
 	// get homedir
 	home, err := homedir.Dir()
@@ -394,7 +319,7 @@ func writeCache (b []byte, cacheFile string) error {
 		return err
 	}
 
-	if err = ioutil.WriteFile(home + "/" + cacheDir + "/" + cacheFile, b, 0644); err != nil {
+	if err = ioutil.WriteFile(cachePath(home, cacheFile), b, 0644); err != nil {
 		return err
 	}
 	return nil
@@ -407,162 +332,320 @@ As spot is much more variable the cache is kept seperatly and updated more often
 
 Both demand and spot data structures are the same (for ease of reuse) and then combined. This is a little wasteful in terms of memory but really not alot.
 
+Demand prices are only fetched for the regions matching region within the geography geo, see getDemandPrices.
+
+Savings plan rates are kept in their own per-region cache and joined on in the same way as spot prices.
+
+The Spot Instance Advisor is only downloaded when needAdvisor is set (--max-interruption), see getSpotAdvisor.
+
+Only documents fetched over the network are cached, local offer files and fixtures are always parsed fresh so they never leak into (or get masked by) the cache.
+
 */
-func getPrices(s *Ec2, forceDownload bool, ignoreSpot bool, skipDownload bool) error {
+func getPrices(s *Ec2, src PriceSource, region string, geo string, workers int, spType string, forceDownload bool, ignoreSpot bool, needAdvisor bool, skipDownload bool) error {
 
 	// First get demand and reserve pricing
-	if forceDownload || readCache(s, "ec2.cache", (24 * time.Hour), skipDownload) != nil {
-			// cache to old download it
-			fmt.Println("Price cache to old fetching new data ...")
-			if err := downloadDemandPrices (s); err != nil {
-				return err
-			}
+	if err := getDemandPrices(s, src, region, geo, workers, forceDownload, skipDownload); err != nil {
+		return err
+	}
 
-			// write processed response to cache
-			b, _ := json.Marshal(s)
-			if err := writeCache(b, "ec2.cache"); err != nil {
-				return err
-			}
+	// savings plans are only looked up when asked for, the offer is large and updated as often as the EC2 one
+	if spType != "" {
+		if err := getSavingsPlans(s, src, spType, forceDownload, skipDownload); err != nil {
+			return err
+		}
 	}
 
 	// now get spot pricing if required
 	if !ignoreSpot {
+		if err := loadRegionAliases(); err != nil {
+			return err
+		}
 		var spot Ec2
-		if forceDownload || readCache(&spot, "spot.cache", (30 * time.Minute), skipDownload) != nil {
-			if err := downloadSpotPrices(&spot); err != nil {
+		remote := src.Remote(ec2SpotPricesURL)
+		if !remote || forceDownload || readCache(&spot, "spot.cache", (30 * time.Minute), skipDownload) != nil {
+			if err := downloadSpotPrices(src, &spot); err != nil {
 				return err
 			}
 
 			// write processed response to cache
-			b, _ := json.Marshal(spot)
-			if err := writeCache(b, "spot.cache"); err != nil {
-				return err
+			if remote {
+				b, _ := json.Marshal(spot)
+				if err := writeCache(b, "spot.cache"); err != nil {
+					return err
+				}
 			}
 		}
 		// combine demand and spot prices
 		if err := combinePrices(s, &spot); err != nil {
 			return err
 		}
+		// and how often each spot pool gets reclaimed
+		if err := getSpotAdvisor(s, src, needAdvisor, forceDownload, skipDownload); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func roundUp(val float64) int {
-    if val > 0 { return int(val+0.999999) }
-    return int(val)
-}
-
-func doFilter(ec2 Ec2, region string, instanceCount int, minInstanceCount int, minCPU int, minFleetCPU int, minMem int, minFleetMem int, minDisk int, diskType string, minNetworkType int, operatingSystem string, instanceType string, riType string, sort string) FilteredResults {
+func doFilter(ec2 Ec2, opts FilterOptions) FilteredResults {
 
 	var output FilteredResults
 
-	r_region := regexp.MustCompile(`(?i).*` + region + `.*`)
-	r_os		 := regexp.MustCompile(`(?i).*` + operatingSystem + `.*`)
-	r_type	 := regexp.MustCompile(`(?i).*` + instanceType + `.*`)
+	r_region := regexp.MustCompile(`(?i).*` + opts.Region + `.*`)
+	r_os		 := regexp.MustCompile(`(?i).*` + opts.OperatingSystem + `.*`)
+	r_type	 := regexp.MustCompile(`(?i).*` + opts.InstanceType + `.*`)
+	r_software := regexp.MustCompile(`(?i).*` + opts.Software + `.*`) // checked by the action
+	r_exclude, _ := excludePatterns(opts.Exclude) // checked by the action
 
 
 	for i := range ec2.Instance {
 		if ! r_region.MatchString(ec2.Instance[i].RegionCode) {
 			continue
 		}
-		if instanceType != "ANY" && ! r_type.MatchString(ec2.Instance[i].Name) {
+		if ! inGeography(ec2.Instance[i].RegionCode, opts.Geography) {
+			continue
+		}
+		if opts.Location != "ANY" && ec2.Regions[ec2.Instance[i].RegionCode].LocationType != locationTypes[opts.Location] {
+			continue
+		}
+		if opts.InstanceType != "ANY" && ! r_type.MatchString(ec2.Instance[i].Name) {
+			continue
+		}
+		if excluded(r_exclude, ec2.Instance[i].Name) {
+			continue
+		}
+		if opts.CurrentOnly && ! ec2.Instance[i].Specs.CurrentGeneration {
+			continue
+		}
+		if ! ec2.Instance[i].Specs.matchesCategory(opts.Category) {
+			continue
+		}
+		if opts.OperatingSystem != "ANY" && ! r_os.MatchString(ec2.Instance[i].Specs.Os) {
+			continue
+		}
+		if opts.Tenancy != "ANY" && opts.Tenancy != strings.ToUpper(ec2.Instance[i].Tenancy) {
+			continue
+		}
+		if opts.License == "BYOL" && ec2.Instance[i].Specs.License != byolLicense {
+			continue
+		}
+		if opts.License == "INCLUDED" && ec2.Instance[i].Specs.License == byolLicense {
+			continue
+		}
+		if opts.Software == "NONE" && ec2.Instance[i].Specs.Software != "NA" {
+			continue
+		}
+		if opts.Software != "NONE" && opts.Software != "ANY" && ! r_software.MatchString(ec2.Instance[i].Specs.Software) {
 			continue
 		}
-		if operatingSystem != "ANY" && ! r_os.MatchString(ec2.Instance[i].Specs.Os) {
+		if opts.MinNetwork > ec2.Instance[i].Specs.networkGbps(opts.NetworkBasis) {
 			continue
 		}
-		if ec2.Instance[i].Specs.NetworkType > minNetworkType { // smaller NetworkType is faster!
+		if ! ec2.Instance[i].Specs.matchesDiskType(opts.DiskType) {
 			continue
 		}
-		if diskType != "ANY" && diskType != ec2.Instance[i].Specs.DiskType {
+		if opts.MinDisk > ec2.Instance[i].Specs.DiskSize {
 			continue
 		}
-		if minDisk > ec2.Instance[i].Specs.DiskSize {
+		if opts.MinCPU > ec2.Instance[i].Specs.Cpu   {
 			continue
 		}
-		if minCPU > ec2.Instance[i].Specs.Cpu   {
+		if opts.MaxCPU > 0 && opts.MaxCPU < ec2.Instance[i].Specs.Cpu {
 			continue
 		}
-		if minMem > int(ec2.Instance[i].Specs.Mem) {
+		if opts.MinMem > int(ec2.Instance[i].Specs.Mem) {
+			continue
+		}
+		if opts.MaxMem > 0 && float64(opts.MaxMem) < ec2.Instance[i].Specs.Mem {
+			continue
+		}
+		if opts.MaxDisk > 0 && opts.MaxDisk < ec2.Instance[i].Specs.DiskSize {
+			continue
+		}
+		if opts.MinGPU > ec2.Instance[i].Specs.Gpu {
+			continue
+		}
+		if float64(opts.MinGPUMem) > ec2.Instance[i].Specs.GpuMem {
+			continue
+		}
+		if ! ec2.Instance[i].Specs.matchesAccelerator(opts.Accelerator) {
+			continue
+		}
+		if ! ec2.Instance[i].Specs.matchesProcessor(opts.Arch, opts.Vendor, opts.CpuFeatures) {
 			continue
 		}
 
 		var numServers int
-		// sort prices will be whatever the sort prices set * num instances required (biggest to meet either mem or cpu limits)
-		if (instanceCount == 1) {
-			if (float64(minFleetMem) / ec2.Instance[i].Specs.Mem) > float64(minFleetCPU / ec2.Instance[i].Specs.Cpu) {
-				numServers = roundUp(float64(minFleetMem) / float64(ec2.Instance[i].Specs.Mem))
-			} else {
-				numServers = roundUp(float64(minFleetCPU) / float64(ec2.Instance[i].Specs.Cpu))
+		var binding string
+		// sort prices will be whatever the sort prices set * num instances required (enough to meet every fleet target)
+		if (opts.InstanceCount == 1) {
+			var ok bool
+			if numServers, binding, ok = fleetSize(ec2.Instance[i], opts); !ok {
+				continue
 			}
-			if numServers < 1 {
-				numServers = 1
+			// one instance in each zone at least
+			if numServers < opts.SpotZones {
+				numServers, binding = opts.SpotZones, "AZs"
 			}
 		} else {
-			numServers = instanceCount
+			numServers = opts.InstanceCount
 		}
 
-		if numServers < minInstanceCount {
+		if numServers < opts.MinInstanceCount {
 			continue
 		}
-
-		var riPrice, riMonCost float64
-		switch riType {
-		case `zero1`:
-			riPrice = ec2.Instance[i].Reserve1YZeroPrice * float64(numServers)
-			riMonCost = 0
-		case `partial1`:
-			riPrice = ec2.Instance[i].Reserve1YPartialPrice * float64(numServers)
-			riMonCost = (ec2.Instance[i].Reserve1YPartialUpfront / 12) * float64(numServers)
-		case `partial3`:
-			riPrice = ec2.Instance[i].Reserve3YPartialPrice * float64(numServers)
-			riMonCost = (ec2.Instance[i].Reserve3YPartialUpfront / 36) * float64(numServers)
-		case `full1`:
-			riPrice = 0
-			riMonCost = (ec2.Instance[i].Reserve1YFullUpfront / 12) * float64(numServers)
-		case `full3`:
-			riPrice = 0
-			riMonCost = (ec2.Instance[i].Reserve1YFullUpfront / 36) * float64(numServers)
-		default:
-			riPrice = ec2.Instance[i].Reserve1YZeroPrice * float64(numServers)
-			riMonCost = 0
+		if opts.MaxInstanceCount > 0 && numServers > opts.MaxInstanceCount {
+			continue
 		}
 
 		var instance Ec2Filtered
 		instance.NumberInstances 	= numServers
+		instance.Binding 					= binding
 		instance.Instance 				= ec2.Instance[i]
 
+		// price spot from the zones the fleet is actually placed in
+		if opts.SpotZones > 0 {
+			price, placement, ok := placeInZones(ec2.Instance[i].SpotZones, numServers, opts.SpotZones)
+			if !ok {
+				continue
+			}
+			instance.Instance.SpotPrice = price
+			instance.Placement = placement
+		}
+
+		// on a Dedicated Host whole hosts are paid for, not instances, plus any per instance license charge
+		billed, demandPrice, spPrice, reservations := float64(numServers), ec2.Instance[i].DemandPrice, ec2.Instance[i].SavingsPlanPrice, ec2.Instance[i].Reservations
+		var licenseMonCost float64
+		if host := ec2.Instance[i].Host; host != nil {
+			billed, demandPrice, spPrice, reservations = float64(host.hostsFor(numServers)), host.DemandPrice, host.SavingsPlanPrice, host.Reservations
+			licenseMonCost = host.LicensePrice * float64(numServers) * 24 * 30
+		}
+
+		var riPrice, riMonCost float64
+		ri, ok := riTypes[opts.RIType]
+		if !ok {
+			ri = riTypes["zero1"]
+		}
+		if r, ok := findReservation(reservations, ri.LeaseContractLength, ri.PurchaseOption, ri.OfferingClass); ok {
+			riPrice = r.Hourly * billed
+			riMonCost = (r.Upfront / float64(r.Months())) * billed
+
+			instance.RIUpfront = r.Upfront * billed
+			instance.RIRecurring = riPrice * 24 * 30
+			instance.RIEffectiveHourly = (riPrice + riMonCost / (24 * 30)) / float64(numServers)
+		}
+
+		// burstable instances worked past their baseline in unlimited mode pay for the surplus credits on top
+		surplusHourly := ec2.Instance[i].surplusHourly(opts)
+		instance.SurplusMonthly = surplusHourly * float64(numServers) * 24 * 30
+		if instance.RIEffectiveHourly > 0 {
+			instance.RIEffectiveHourly += surplusHourly
+		}
+
 		// calculate monthly costs for demand, spot and choosen RI
-		instance.TotalPriceDemand = ec2.Instance[i].DemandPrice * float64(numServers) * 24 * 30
-		instance.TotalPriceSpot   = ec2.Instance[i].SpotPrice * float64(numServers) * 24 * 30
+		instance.TotalPriceDemand = demandPrice * billed * 24 * 30 + licenseMonCost + instance.SurplusMonthly
+		instance.TotalPriceSpot   = instance.Instance.SpotPrice * float64(numServers) * 24 * 30
 		instance.TotalPriceRI     = (riPrice * 24 * 30) + riMonCost
 
+		if instance.Instance.SpotPrice != 999999.9 && instance.Instance.SpotPrice > 0 {
+			instance.TotalPriceSpot += instance.SurplusMonthly
+		}
+
 		if instance.TotalPriceRI == 0 {
 			instance.TotalPriceRI = 999999999.999999
+		} else {
+			instance.TotalPriceRI += licenseMonCost + instance.SurplusMonthly
 		}
 
-		switch sort {
+		instance.TotalPriceSP = spPrice * billed * 24 * 30
+		if instance.TotalPriceSP == 0 {
+			instance.TotalPriceSP = 999999999.999999
+		} else {
+			instance.TotalPriceSP += licenseMonCost + instance.SurplusMonthly
+		}
+
+		switch opts.Sort {
 			case `demand`:
 				instance.SortPrice = instance.TotalPriceDemand
 			case `spot`:
 				instance.SortPrice = instance.TotalPriceSpot
 			case `ri`:
 				instance.SortPrice = instance.TotalPriceRI
+			case `sp`:
+				instance.SortPrice = instance.TotalPriceSP
 			default:
 				instance.SortPrice = instance.TotalPriceDemand
 		}
 
+		instance.setMetrics(opts.MetricModel)
+		if metric, ok := metricSorts[opts.Sort]; ok {
+			instance.SortPrice = sortMetric(metric(instance))
+		}
+		if history, ok := historySorts[opts.Sort]; ok {
+			instance.SortPrice = sortMetric(history(instance))
+		}
+
+		if ! ec2.Instance[i].withinInterruption(opts.MaxInterruption) {
+			continue
+		}
+		if ! opts.MaxHourly.within(instance.hourlyPrice) || ! opts.MaxMonthly.within(instance.monthlyPrice) {
+			continue
+		}
+		if ! opts.Where.Match(instance) {
+			continue
+		}
+
 		output = append(output, instance)
 	}
 
 	return output
 }
 
-func doDisplay (output FilteredResults, outputSize int) {
+func doDisplay (output FilteredResults, outputSize int, opts FilterOptions) {
+
+	// licenses only matter once something other than plain linux is being looked at
+	showSP := opts.SPType != ""
+	showLicense := opts.OperatingSystem != "LINUX" || opts.License != "INCLUDED" || opts.Software != "NONE"
+	_, sortedOnMetric := metricSorts[opts.Sort]
+	showMetrics := opts.ShowMetrics || sortedOnMetric
+	// rows of different regions can't be told apart otherwise
+	showRegion := len(output.regions()) > 1
 
 	sort.Sort(output)
 
+	shown := output
+	if len(shown) > outputSize {
+		shown = shown[:outputSize]
+	}
+	// which resource sized the fleet only matters once it takes more than one instance
+	showBinding := false
+	showGPU := false
+	showBurst := false
+	showInterruption := false
+	showHistory := false
+	showZones := false
+	for _, s := range shown {
+		if s.Binding != "" && s.NumberInstances > 1 {
+			showBinding = true
+		}
+		if s.Instance.Specs.Accelerator != "" {
+			showGPU = true
+		}
+		if s.Instance.Specs.Burstable {
+			showBurst = true
+		}
+		if s.Instance.Interruption != nil {
+			showInterruption = true
+		}
+		if s.Instance.SpotHistory != nil {
+			showHistory = true
+		}
+		if len(s.Instance.SpotZones) > 0 {
+			showZones = true
+		}
+	}
+
 	var data [][]string
 	i := 1
 	for _, s := range output {
@@ -576,46 +659,173 @@ func doDisplay (output FilteredResults, outputSize int) {
 		demandString := "$" + strconv.FormatFloat(s.Instance.DemandPrice * float64(s.NumberInstances), 'f', 2, 64)
 		spotString := "$" + strconv.FormatFloat(s.Instance.SpotPrice * float64(s.NumberInstances), 'f', 2, 64)
 
+		if s.Instance.Host != nil {
+			// whole hosts are billed, the per instance price is what it costs on a fully packed host
+			demandString = "$" + strconv.FormatFloat(s.TotalPriceDemand / (24 * 30), 'f', 2, 64)
+		}
+
 		if s.NumberInstances > 1 {
 			demandString = demandString + " ($" + strconv.FormatFloat(s.Instance.DemandPrice, 'f', 2, 64) + " ea)"
 			spotString = spotString + " ($" + strconv.FormatFloat(s.Instance.SpotPrice, 'f', 2, 64) + " ea)"
 		}
 
+		countString := strconv.FormatInt(int64(s.NumberInstances), 10)
+		if s.Instance.Host != nil {
+			hosts := s.Instance.Host.hostsFor(s.NumberInstances)
+			countString = countString + " (" + strconv.Itoa(hosts) + " host(s), " + strconv.Itoa(s.Instance.Host.InstancesPerHost) + "/host)"
+		}
+
 		result := []string{
-			strconv.FormatInt(int64(s.NumberInstances), 10),
+			countString,
 			s.Instance.Name,
 			strconv.FormatInt(int64(s.Instance.Specs.Cpu), 10),
 			s.Instance.Specs.CpuClock,
+			s.Instance.Specs.processorDesc(),
 			strconv.FormatFloat(s.Instance.Specs.Mem, 'f', 1, 64),
 			s.Instance.Specs.NetworkDesc,
 			s.Instance.Specs.DiskType,
 			strconv.FormatInt(int64(s.Instance.Specs.DiskSize), 10) + " GB",
+			s.Instance.Specs.diskLayout(),
 			demandString,
 			spotString,
 			strconv.FormatFloat(spotSaving, 'f', 0, 64) + "%",
 			"$" +   humanize.Comma(int64(s.TotalPriceDemand)),
 			"$" + 	humanize.Comma(int64(s.TotalPriceRI)),
 			"$" + 	humanize.Comma(int64(s.TotalPriceSpot)),
+			"$" + 	humanize.Comma(int64(s.RIUpfront)),
+			"$" + 	humanize.Comma(int64(s.RIRecurring)),
+			"$" + strconv.FormatFloat(s.RIEffectiveHourly, 'f', 3, 64),
 		}
 		if s.Instance.SpotPrice == 999999.9 {
-			result[9] = "N/A"
-			result[10] = "N/A"
-			result[13] = "N/A"
+			result[11] = "N/A"
+			result[12] = "N/A"
+			result[15] = "N/A"
 		}
 		if s.Instance.Specs.DiskSize == 0 {
-			result[6] = "N/A"
 			result[7] = "N/A"
+			result[8] = "N/A"
+			result[9] = "N/A"
 		}
 		if s.TotalPriceRI == 999999999.999999 {
-			result[12] = "N/A"
+			result[14] = "N/A"
+			result[16] = "N/A"
+			result[17] = "N/A"
+			result[18] = "N/A"
+		}
+
+		if showInterruption {
+			result = append(result, s.Instance.interruptionDesc())
+		}
+		if showHistory {
+			if h := s.Instance.SpotHistory; h != nil {
+				result = append(result,
+					"$" + strconv.FormatFloat(h.Min, 'f', 4, 64),
+					"$" + strconv.FormatFloat(h.Mean, 'f', 4, 64),
+					"$" + strconv.FormatFloat(h.P95, 'f', 4, 64),
+					"$" + strconv.FormatFloat(h.Max, 'f', 4, 64),
+					"$" + strconv.FormatFloat(h.StdDev, 'f', 4, 64),
+					"$" + humanize.Comma(int64(historySorts["spot-p95"](s))),
+				)
+			} else {
+				result = append(result, "N/A", "N/A", "N/A", "N/A", "N/A", "N/A")
+			}
+		}
+		if showZones {
+			result = append(result, s.Instance.cheapestZoneDesc(), formatMetric(s.Instance.zoneSpread(), "", 0) + "%")
+			if opts.SpotZones > 0 {
+				result = append(result, s.Placement)
+			}
+		}
+
+		if showSP {
+			spString := "$" + strconv.FormatFloat(s.Instance.SavingsPlanPrice * float64(s.NumberInstances), 'f', 2, 64)
+			if s.NumberInstances > 1 {
+				spString = spString + " ($" + strconv.FormatFloat(s.Instance.SavingsPlanPrice, 'f', 2, 64) + " ea)"
+			}
+			spMonString := "$" + humanize.Comma(int64(s.TotalPriceSP))
+			if s.TotalPriceSP == 999999999.999999 {
+				spString = "N/A"
+				spMonString = "N/A"
+			}
+			result = append(result, spString, spMonString)
+		}
+
+		if showLicense {
+			result = append(result, s.Instance.platform(), "$" + strconv.FormatFloat(s.Instance.LicensePremium, 'f', 3, 64))
+		}
+		if showMetrics {
+			result = append(result,
+				formatMetric(s.MemPerVcpu, "", 1),
+				formatMetric(s.VcpuHour, "$", 4),
+				formatMetric(s.GiBHour, "$", 4),
+				formatMetric(s.EcuHour, "$", 4),
+				formatMetric(s.GHzCoreHour, "$", 4),
+			)
+		}
+		if showGPU {
+			gpuString, perGPUString := s.Instance.Specs.acceleratorDesc(), ""
+			// priced under the model the output is sorted by (a metric sort's --metric-price), spot GPUs are what most
+			// training runs on
+			if monthly, ok := s.monthlyPrice(sortModel(opts)); s.Instance.Specs.Gpu > 0 && ok {
+				perGPUString = "$" + strconv.FormatFloat(monthly / (24 * 30) / float64(s.Instance.Specs.Gpu * s.NumberInstances), 'f', 3, 64)
+			}
+			result = append(result, gpuString, perGPUString)
+		}
+		if showBurst {
+			surplusString := ""
+			if s.Instance.Specs.Burstable && opts.CreditMode == "UNLIMITED" {
+				surplusString = "$" + humanize.Comma(int64(s.SurplusMonthly))
+			}
+			result = append(result, s.Instance.Specs.baselineDesc(), surplusString)
+		}
+		if showBinding {
+			result = append(result, s.Binding)
+		}
+		if showRegion {
+			result = append([]string{s.Instance.RegionCode}, result...)
 		}
 
 		data = append(data, result)
 		i++
 	}
+	header := []string{"# Inst", "Type", "VCPU", "VCPU Freq", "Processor", "Mem", "Network", "IS Type", "IS Size", "IS Layout", "Demand/Hour", "Spot/Hour", "Spot Sav", "Demand/Mon", "RI/Mon", "Spot/Mon", "RI Upfront", "RI Recur/Mon", "RI Eff/Hour"}
+	if showInterruption {
+		header = append(header, "Interruption")
+	}
+	if showHistory {
+		header = append(header, "Spot Min/Hour", "Spot Mean/Hour", "Spot P95/Hour", "Spot Max/Hour", "Spot StdDev", "Spot P95/Mon")
+	}
+	if showZones {
+		header = append(header, "Cheapest AZ", "AZ Spread")
+		if opts.SpotZones > 0 {
+			header = append(header, "AZ Placement")
+		}
+	}
+	if showSP {
+		header = append(header, "SP/Hour", "SP/Mon")
+	}
+	if showLicense {
+		header = append(header, "Platform", "Lic Prem/Hour")
+	}
+	if showMetrics {
+		header = append(header, "Mem/VCPU", "$/VCPU-Hour", "$/GiB-Hour", "$/ECU-Hour", "$/GHz-Hour")
+	}
+	if showGPU {
+		header = append(header, "Accelerators", "$/GPU-Hour")
+	}
+	if showBurst {
+		header = append(header, "Baseline", "Surplus/Mon")
+	}
+	if showBinding {
+		header = append(header, "Binding")
+	}
+	if showRegion {
+		header = append([]string{"Region"}, header...)
+	}
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"# Inst", "Type", "VCPU", "VCPU Freq", "Mem", "Network", "IS Type", "IS Size", "Demand/Hour", "Spot/Hour", "Spot Sav", "Demand/Mon", "RI/Mon", "Spot/Mon"})
+	table.SetHeader(header)
 	table.SetBorder(true)                                // Set Border to false
+	table.SetAutoWrapText(false)                         // keep processor and accelerator names on one line
 	table.AppendBulk(data)                                // Add Bulk Data
 	table.Render()
 }
@@ -630,98 +840,359 @@ func main() {
 	app.Usage = "Use this app to find the cheapest price for a single or set of EC2 instances given your CPU, memory or network requirements. \n\tGiven a minimum or maximum fleet size and the required resources across the fleet this app will find the cheapest EC2 instances that will fulfil your requirements."
 	app.Version = "1.0.0"
 
-	var minNetwork, region, diskType, operatingSystem, sort, instanceType, riType string
-	var instanceCount,  minInstanceCount, minCPU, minDisk, minFleetCPU, minMem, minFleetMem, outputSize int
-	var forceDownload, ignoreSpot, skipDownload bool
+	var opts FilterOptions
+	var minNetwork, maxHourly, maxMonthly, where, pricesFile, spotFile, advisorFile, historyFile, historyWindow, spFile, fixtureDir string
+	var outputSize, workers, maxTypes, diversify, maxPools int
+	var tolerance float64
+	var weight string
+	var forceDownload, ignoreSpot, skipDownload, pivot, mix bool
 	app.Flags = []cli.Flag{
 		cli.IntFlag{
 			Name:        "num, n",
 			Value:       1,
 			Usage:       "Number of instances required in fleet - leave at default unless you have specfic requirements for X instances",
-			Destination: &instanceCount,
+			Destination: &opts.InstanceCount,
 		},
 		cli.IntFlag{
 			Name:        "min, mn",
 			Value:       1,
 			Usage:       "Minimum number of instances required in fleet",
-			Destination: &minInstanceCount,
+			Destination: &opts.MinInstanceCount,
 		},
 		cli.StringFlag{
 			Name:        "region, r",
 			Value:       "us-east-1",
-			Usage:       "The EC2 region to perform price checks on",
-			Destination: &region,
+			Usage:       "The EC2 region to perform price checks on, partial matching is supported i.e eu-west, ap-, or any for every region",
+			Destination: &opts.Region,
+		},
+		cli.StringFlag{
+			Name:        "geo, g",
+			Value:       "any",
+			Usage:       "Only consider regions in this geography, a comma separated list of region prefixes i.e us, eu, ap, us,ca or any",
+			Destination: &opts.Geography,
+		},
+		cli.StringFlag{
+			Name:        "location",
+			Value:       "region",
+			Usage:       "Type of location to include, options: region, local (Local Zones), wavelength (Wavelength Zones), outposts, any",
+			Destination: &opts.Location,
 		},
 		cli.StringFlag{
 			Name:        "instance, i",
 			Value:       "any",
 			Usage:       "EC2 instance type. partial matching is supported i.e c4, m4, c4.large, xl etc",
-			Destination: &instanceType,
+			Destination: &opts.InstanceType,
+		},
+		cli.StringFlag{
+			Name:        "exclude, ex",
+			Usage:       "Instance types to leave out, a comma separated list matched like --instance i.e cc2,cr1,m1 or ^t",
+			Destination: &opts.Exclude,
+		},
+		cli.BoolFlag{
+			Name:        "current-only, cur",
+			Usage:       "Only current generation instance types",
+			Destination: &opts.CurrentOnly,
+		},
+		cli.StringFlag{
+			Name:        "category, cat",
+			Value:       "any",
+			Usage:       "Instance category, partial matching of a comma separated list is supported. options: any, general, compute, memory, storage, gpu, fpga, machine learning",
+			Destination: &opts.Category,
 		},
 		cli.IntFlag{
 			Name:        "cpu, c",
 			Value:       2,
 			Usage:       "Minimum CPU cores required per instance",
-			Destination: &minCPU,
+			Destination: &opts.MinCPU,
 		},
 		cli.IntFlag{
 			Name:        "mem, m",
 			Value:       2,
 			Usage:       "Minimum memoy (in GiB) required per instance",
-			Destination: &minMem,
+			Destination: &opts.MinMem,
+		},
+		cli.IntFlag{
+			Name:        "maxcpu, xc",
+			Usage:       "Maximum CPU cores per instance, 0 for no limit",
+			Destination: &opts.MaxCPU,
+		},
+		cli.IntFlag{
+			Name:        "maxmem, xm",
+			Usage:       "Maximum memory (in GiB) per instance, 0 for no limit",
+			Destination: &opts.MaxMem,
+		},
+		cli.IntFlag{
+			Name:        "maxdisk, xd",
+			Usage:       "Maximum instance store disk space (in GiB) per instance, 0 for no limit",
+			Destination: &opts.MaxDisk,
+		},
+		cli.IntFlag{
+			Name:        "max, mx",
+			Usage:       "Maximum number of instances in fleet, 0 for no limit",
+			Destination: &opts.MaxInstanceCount,
+		},
+		cli.StringFlag{
+			Name:        "max-hourly",
+			Usage:       "Maximum price per instance per hour, under the --sort pricing model or per model i.e spot=0.2,demand=0.5 (models: demand, spot, ri, sp)",
+			Destination: &maxHourly,
+		},
+		cli.StringFlag{
+			Name:        "max-monthly",
+			Usage:       "Maximum monthly cost of the whole fleet, under the --sort pricing model or per model i.e ri=5000,demand=8000",
+			Destination: &maxMonthly,
+		},
+		cli.Float64Flag{
+			Name:        "max-interruption, mi",
+			Value:       0,
+			Usage:       "Maximum spot interruption frequency (in %) per the Spot Instance Advisor i.e. 10 keeps the <5% and 5-10% pools, 0 for any",
+			Destination: &opts.MaxInterruption,
 		},
 		cli.IntFlag{
 			Name:        "fleetcpu, fc",
 			Value:       2,
 			Usage:       "Minimum CPU virtual cores required across fleet",
-			Destination: &minFleetCPU,
+			Destination: &opts.MinFleetCPU,
+		},
+		cli.Float64Flag{
+			Name:        "cpu-util, cu",
+			Value:       100,
+			Usage:       "Expected average CPU utilization (in %), burstable instances are sized and charged against their baseline at it",
+			Destination: &opts.CpuUtil,
+		},
+		cli.StringFlag{
+			Name:        "credits",
+			Value:       "standard",
+			Usage:       "How burstable instances run past their baseline, options: standard (held at baseline, fewer usable vCPUs), unlimited (surplus credits charged)",
+			Destination: &opts.CreditMode,
 		},
 		cli.IntFlag{
 			Name:        "fleetmem, fm",
 			Value:       2,
 			Usage:       "Minimum memoy (in GiB) required across fleet",
-			Destination: &minFleetMem,
+			Destination: &opts.MinFleetMem,
+		},
+		cli.IntFlag{
+			Name:        "fleetdisk, fd",
+			Value:       0,
+			Usage:       "Minimum instance store disk space (in GB) required across fleet",
+			Destination: &opts.MinFleetDisk,
+		},
+		cli.Float64Flag{
+			Name:        "fleetnet, fn",
+			Value:       0,
+			Usage:       "Minimum aggregate network bandwidth (in Gbps) required across fleet",
+			Destination: &opts.MinFleetNetwork,
+		},
+		cli.IntFlag{
+			Name:        "fleetgpu, fg",
+			Value:       0,
+			Usage:       "Minimum number of GPUs / accelerators required across fleet",
+			Destination: &opts.MinFleetGPU,
 		},
 		cli.StringFlag{
 			Name:        "network, nw",
 			Value:       "low",
-			Usage:       "Minimum network speed required per instance, options: low, medium, high, gbit",
+			Usage:       "Minimum network speed required per instance, in Gbps i.e 25, or one of low, medium, high, gbit (10)",
 			Destination: &minNetwork,
 		},
+		cli.StringFlag{
+			Name:        "network-basis, nb",
+			Value:       "burst",
+			Usage:       "Network rate --network is compared against, options: burst (the rating, i.e 10 for Up to 10 Gigabit), baseline (sustained, estimated for Up to ratings)",
+			Destination: &opts.NetworkBasis,
+		},
 		cli.IntFlag{
 			Name:        "disk, d",
 			Value:       0,
 			Usage:       "Minimum instance store disk space required (in GiB) per instance",
-			Destination: &minDisk,
+			Destination: &opts.MinDisk,
+		},
+		cli.IntFlag{
+			Name:        "gpu",
+			Value:       0,
+			Usage:       "Minimum number of GPUs required per instance",
+			Destination: &opts.MinGPU,
+		},
+		cli.IntFlag{
+			Name:        "gpuMem",
+			Value:       0,
+			Usage:       "Minimum GPU memory (in GiB, across all GPUs) required per instance",
+			Destination: &opts.MinGPUMem,
+		},
+		cli.StringFlag{
+			Name:        "accelerator, ac",
+			Value:       "any",
+			Usage:       "Accelerator required, partial matching on model or kind is supported i.e nvidia, v100, a100, inferentia, trainium, fpga. options: any, none or a match",
+			Destination: &opts.Accelerator,
+		},
+		cli.StringFlag{
+			Name:        "arch",
+			Value:       "any",
+			Usage:       "CPU architecture required, options: any, x86_64, arm64",
+			Destination: &opts.Arch,
+		},
+		cli.StringFlag{
+			Name:        "vendor",
+			Value:       "any",
+			Usage:       "CPU vendor required, options: any, intel, amd, aws (Graviton), apple or a match on the processor name i.e graviton3",
+			Destination: &opts.Vendor,
+		},
+		cli.StringFlag{
+			Name:        "cpu-feature",
+			Value:       "any",
+			Usage:       "CPU features required, a comma separated list which must all be present i.e avx512, avx2,turbo",
+			Destination: &opts.CpuFeatures,
 		},
 		cli.StringFlag{
 			Name:        "diskType, dt",
 			Value:       "any",
-			Usage:       "Type of instance store disk required, options: any, hdd, ssd",
-			Destination: &diskType,
+			Usage:       "Type of instance store disk required, options: any, hdd, ssd (including NVMe), nvme",
+			Destination: &opts.DiskType,
 		},
 		cli.StringFlag{
 			Name:        "operatingSystem, os",
 			Value:       "linux",
 			Usage:       "Type of OS required, options: any, linux, windows, rhel, suse",
-			Destination: &operatingSystem,
+			Destination: &opts.OperatingSystem,
+		},
+		cli.StringFlag{
+			Name:        "tenancy, t",
+			Value:       "shared",
+			Usage:       "Instance tenancy required, options: shared, dedicated (dedicated instances), host (dedicated hosts, priced per host), any",
+			Destination: &opts.Tenancy,
+		},
+		cli.StringFlag{
+			Name:        "license, l",
+			Value:       "included",
+			Usage:       "License model required, options: included (license included or none required), byol (bring your own license), any",
+			Destination: &opts.License,
+		},
+		cli.StringFlag{
+			Name:        "software, sw",
+			Value:       "none",
+			Usage:       "Pre-installed software required, partial matching is supported i.e sql, sql std, sql ent. options: none, any or a match",
+			Destination: &opts.Software,
+		},
+		cli.StringFlag{
+			Name:        "where, wh",
+			Usage:       "Only instances for which this expression is true i.e 'mem/vcpu >= 8 && network_gbps >= 25 && spot_savings > 60', an unknown field lists the fields available",
+			Destination: &where,
 		},
 		cli.StringFlag{
 			Name:        "sort, s",
 			Value:       "demand",
-			Usage:       "Sort choice (always low to high), options: demand, spot, ri",
-			Destination: &sort,
+			Usage:       "Sort choice (always low to high), options: demand, spot, ri, sp a metric: mem-per-vcpu, vcpu-hour, gib-hour, ecu-hour, ghz-hour or with --spot-history: spot-min, spot-mean, spot-p95, spot-max, spot-stddev",
+			Destination: &opts.Sort,
+		},
+		cli.BoolFlag{
+			Name:        "metrics",
+			Usage:       "Show derived metrics: memory per vCPU and the hourly price per vCPU, GiB, ECU and GHz-core",
+			Destination: &opts.ShowMetrics,
+		},
+		cli.StringFlag{
+			Name:        "metric-price",
+			Value:       "demand",
+			Usage:       "Pricing model the per vCPU, GiB, ECU and GHz metrics are computed on, options: demand, spot, ri, sp",
+			Destination: &opts.MetricModel,
 		},
 		cli.BoolFlag{
 			Name:        "force, f",
 			Usage:       "Force download of latest version of AWS EC2 pricing file",
 			Destination: &forceDownload,
 		},
+		cli.StringFlag{
+			Name:        "prices-file",
+			Usage:       "Read the EC2 offer file (index.json) from this local path or file:// URL instead of downloading it",
+			Destination: &pricesFile,
+		},
+		cli.StringFlag{
+			Name:        "spot-file",
+			Usage:       "Read the spot price feed (spot.js) from this local path or file:// URL instead of downloading it",
+			Destination: &spotFile,
+		},
+		cli.StringFlag{
+			Name:        "spot-advisor-file",
+			Usage:       "Read the Spot Instance Advisor data (spot-advisor-data.json) from this local path or file:// URL instead of downloading it",
+			Destination: &advisorFile,
+		},
+		cli.StringFlag{
+			Name:        "spot-history",
+			Usage:       "Read spot price history (the JSON output of EC2 DescribeSpotPriceHistory) from this local path or URL, for min, mean, p95, max and stddev columns",
+			Destination: &historyFile,
+		},
+		cli.StringFlag{
+			Name:        "history-window",
+			Value:       "7d",
+			Usage:       "Window of spot price history the statistics are taken over, ending at its newest price i.e. 30d, 36h",
+			Destination: &historyWindow,
+		},
+		cli.IntFlag{
+			Name:        "azs",
+			Value:       0,
+			Usage:       "Spread the fleet across this many of the cheapest availability zones and price spot from their prices, needs --spot-history",
+			Destination: &opts.SpotZones,
+		},
+		cli.StringFlag{
+			Name:        "sp-file",
+			Usage:       "Read the Savings Plans offer file from this local path or file:// URL instead of downloading it",
+			Destination: &spFile,
+		},
+		cli.StringFlag{
+			Name:        "fixtures",
+			Usage:       "Read every pricing document from this directory (laid out like the AWS URL paths, or flat by file name), nothing is downloaded or cached",
+			Destination: &fixtureDir,
+		},
 		cli.BoolFlag{
 			Name:        "skip",
 			Usage:       "Skip download of pricing even if cache is old, good for offline use",
 			Destination: &skipDownload,
 		},
+		cli.IntFlag{
+			Name:        "workers, w",
+			Value:       runtime.NumCPU(),
+			Usage:       "Number of parallel workers used to parse the EC2 offer file",
+			Destination: &workers,
+		},
+		cli.BoolFlag{
+			Name:        "pivot, p",
+			Usage:       "Compare regions side by side, one row per instance type and one column per region showing the --sort price, plus the cheapest region for each pricing model",
+			Destination: &pivot,
+		},
+		cli.BoolFlag{
+			Name:        "mix, x",
+			Usage:       "Find the cheapest mix of instance types (and how many of each) that meets --fleetcpu, --fleetmem and --min, priced by --sort",
+			Destination: &mix,
+		},
+		cli.IntFlag{
+			Name:        "maxTypes, mt",
+			Value:       3,
+			Usage:       "Maximum number of distinct instance types in a --mix fleet",
+			Destination: &maxTypes,
+		},
+		cli.IntFlag{
+			Name:        "diversify, dv",
+			Value:       0,
+			Usage:       "Spread a spot fleet over every capacity pool (instance type and availability zone) within --tolerance of the cheapest, needing at least this many, 0 for off",
+			Destination: &diversify,
+		},
+		cli.IntFlag{
+			Name:        "max-pools",
+			Value:       0,
+			Usage:       "Most capacity pools a --diversify fleet is spread over, the cheapest per unit, 0 for every pool within --tolerance",
+			Destination: &maxPools,
+		},
+		cli.Float64Flag{
+			Name:        "tolerance",
+			Value:       20,
+			Usage:       "How much dearer (in %) per --weight unit than the cheapest a --diversify pool may be",
+			Destination: &tolerance,
+		},
+		cli.StringFlag{
+			Name:        "weight",
+			Value:       "vcpu",
+			Usage:       "What makes --diversify pools interchangeable and sizes the fleet, options: vcpu (--fleetcpu), mem (--fleetmem), which must be given",
+			Destination: &weight,
+		},
 		cli.IntFlag{
 			Name:        "outputSize, o",
 			Value:       20,
@@ -731,25 +1202,205 @@ func main() {
 		cli.StringFlag{
 			Name:        "riType, ri",
 			Value:       "partial1",
-			Usage:       "Type of RI type to display, options: zero1, partial1, partial3, full1, full3",
-			Destination: &riType,
+			Usage:       "Type of RI type to display, options: zero1, partial1, full1, zero3, partial3, full3 (standard) or the same prefixed with conv- for convertible i.e conv-partial3",
+			Destination: &opts.RIType,
+		},
+		cli.StringFlag{
+			Name:        "sp",
+			Usage:       "Type of Savings Plan to price and display, options: zero1, partial1, full1, zero3, partial3, full3 (Compute) or the same prefixed with ec2- for EC2 Instance Savings Plans i.e ec2-zero3",
+			Destination: &opts.SPType,
 		},
 	}
 	app.Action = func(c *cli.Context) error {
+			if _, ok := riTypes[opts.RIType]; !ok {
+				err := errors.New("Unknown RI type " + opts.RIType)
+				printError(err.Error())
+				return err
+			}
+
+			if _, ok := spTypes[opts.SPType]; opts.SPType != "" && !ok {
+				err := errors.New("Unknown savings plan type " + opts.SPType + ", options: " + strings.Join(spTypeNames(), ", "))
+				printError(err.Error())
+				return err
+			}
+
+			var err error
+			opts.MinNetwork, err = parseNetwork(minNetwork)
+			if err != nil {
+				printError(err.Error())
+				return err
+			}
+			if _, ok := pricingModelNames[opts.MetricModel]; !ok {
+				err := errors.New("Unknown metric price " + opts.MetricModel + ", options: " + strings.Join(pricingModels, ", "))
+				printError(err.Error())
+				return err
+			}
+			// a diversified fleet is all spot, so that is what a bare ceiling applies to
+			limitModel := sortModel(opts)
+			if diversify > 0 {
+				limitModel = "spot"
+			}
+			if opts.MaxHourly, err = parsePriceLimits(maxHourly, limitModel); err != nil {
+				printError(err.Error())
+				return err
+			}
+			if opts.MaxMonthly, err = parsePriceLimits(maxMonthly, limitModel); err != nil {
+				printError(err.Error())
+				return err
+			}
+			opts.NetworkBasis    = strings.ToUpper(opts.NetworkBasis)
+			if opts.NetworkBasis != "BURST" && opts.NetworkBasis != "BASELINE" {
+				err := errors.New("Unknown network basis " + opts.NetworkBasis + ", options: burst, baseline")
+				printError(err.Error())
+				return err
+			}
+			opts.CreditMode      = strings.ToUpper(opts.CreditMode)
+			if opts.CreditMode != "STANDARD" && opts.CreditMode != "UNLIMITED" {
+				err := errors.New("Unknown credit mode " + opts.CreditMode + ", options: standard, unlimited")
+				printError(err.Error())
+				return err
+			}
+			if opts.CpuUtil <= 0 || opts.CpuUtil > 100 {
+				err := errors.New("CPU utilization must be over 0 and at most 100%")
+				printError(err.Error())
+				return err
+			}
+			if _, err = excludePatterns(opts.Exclude); err != nil {
+				printError(err.Error())
+				return err
+			}
+			if _, err = regexp.Compile(`(?i).*` + opts.Software + `.*`); err != nil {
+				err = fmt.Errorf("Invalid --software pattern %q: %v", opts.Software, err)
+				printError(err.Error())
+				return err
+			}
+			if opts.Where, err = parseWhere(where); err != nil {
+				printError(err.Error())
+				return err
+			}
+
+			window, err := parseWindow(historyWindow)
+			if err != nil {
+				printError(err.Error())
+				return err
+			}
+
+			if !validSort(opts.Sort) {
+				msg := "Unknown sort " + opts.Sort + ", options: " + strings.Join(sortNames(), ", ")
+				if hyphenated := strings.Replace(opts.Sort, "_", "-", -1); validSort(hyphenated) {
+					msg = "Unknown sort " + opts.Sort + ", sort keys are hyphenated i.e. " + hyphenated
+				}
+				err := errors.New(msg)
+				printError(err.Error())
+				return err
+			}
+			if _, ok := historySorts[opts.Sort]; ok && (historyFile == "" || ignoreSpot) {
+				err := errors.New("--sort " + opts.Sort + " needs --spot-history for the spot price statistics")
+				printError(err.Error())
+				return err
+			}
+			if opts.Sort == "sp" && opts.SPType == "" {
+				err := errors.New("--sort sp needs --sp for the savings plan prices")
+				printError(err.Error())
+				return err
+			}
+
+			if opts.SpotZones < 0 || (opts.SpotZones > 0 && (historyFile == "" || ignoreSpot)) {
+				err := errors.New("--azs needs --spot-history for the availability zone prices")
+				printError(err.Error())
+				return err
+			}
+			if opts.MaxInterruption > 0 && ignoreSpot {
+				err := errors.New("--max-interruption filters spot pools, it needs the spot prices")
+				printError(err.Error())
+				return err
+			}
+			if opts.InstanceCount > 1 && opts.SpotZones > opts.InstanceCount {
+				err := errors.New("--azs " + strconv.Itoa(opts.SpotZones) + " can't spread a fleet of --num " + strconv.Itoa(opts.InstanceCount) + " instances, it takes at least one per zone")
+				printError(err.Error())
+				return err
+			}
+			if diversify > 0 {
+				w, ok := divWeights[strings.ToLower(weight)]
+				if !ok {
+					err := errors.New("Unknown weight " + weight + ", options: vcpu, mem")
+					printError(err.Error())
+					return err
+				}
+				if !c.IsSet(w.flag) {
+					err := errors.New("--diversify by " + strings.ToLower(weight) + " needs the fleet size it is to reach, set --" + w.flag)
+					printError(err.Error())
+					return err
+				}
+			}
+			if opts.SpotZones > 0 && (mix || diversify > 0) {
+				err := errors.New("--azs places a fleet of one instance type, it can't be combined with --mix or --diversify")
+				printError(err.Error())
+				return err
+			}
+
+			opts.Location = strings.ToUpper(opts.Location)
+			if _, ok := locationTypes[opts.Location]; !ok && opts.Location != "ANY" {
+				err := errors.New("Unknown location " + opts.Location + ", options: " + strings.Join(locationNames(), ", "))
+				printError(err.Error())
+				return err
+			}
+
+			if strings.ToUpper(opts.Region) == "ANY" {
+				opts.Region = ""
+			}
+
 			var prices Ec2
-			err := getPrices(&prices, forceDownload, ignoreSpot, skipDownload)
+			src := newPriceSource(fixtureDir, pricesFile, spotFile, advisorFile, spFile)
+			err = getPrices(&prices, src, opts.Region, opts.Geography, workers, opts.SPType, forceDownload, ignoreSpot, opts.MaxInterruption > 0, skipDownload)
 			if err != nil {
 				printError(err.Error())
 				return err
 			}
+			if opts.MaxInterruption > 0 && !prices.hasInterruption() {
+				printWarning("No Spot Instance Advisor data was loaded, --max-interruption leaves no instance")
+			}
+			if historyFile != "" && !ignoreSpot {
+				if err := getSpotHistory(&prices, src, historyFile, window, forceDownload, skipDownload); err != nil {
+					printError(err.Error())
+					return err
+				}
+			}
+
+			opts.DiskType 				= strings.ToUpper(opts.DiskType)
+			opts.OperatingSystem = strings.ToUpper(opts.OperatingSystem)
+			opts.InstanceType    = strings.ToUpper(opts.InstanceType)
+			opts.Tenancy         = strings.ToUpper(opts.Tenancy)
+			opts.License         = strings.ToUpper(opts.License)
+			opts.Software        = strings.ToUpper(opts.Software)
+			opts.Accelerator     = strings.ToUpper(opts.Accelerator)
+			opts.Category        = strings.ToUpper(opts.Category)
+			opts.Arch            = strings.ToUpper(opts.Arch)
+			opts.Vendor          = strings.ToUpper(opts.Vendor)
+			opts.CpuFeatures     = strings.ToUpper(opts.CpuFeatures)
+
+			if diversify > 0 {
+				if err := doDiversify(prices, opts, diversify, maxPools, tolerance, strings.ToLower(weight)); err != nil {
+					printError(err.Error())
+					return err
+				}
+				return nil
+			}
 
-			minNetworkType := networkMap[minNetwork]
-			diskType 				= strings.ToUpper(diskType)
-			operatingSystem = strings.ToUpper(operatingSystem)
-			instanceType    = strings.ToUpper(instanceType)
+			if mix {
+				if err := doMix(prices, opts, maxTypes); err != nil {
+					printError(err.Error())
+					return err
+				}
+				return nil
+			}
 
-			filtered := doFilter(prices, region, instanceCount, minInstanceCount, minCPU, minFleetCPU, minMem, minFleetMem, minDisk, diskType, minNetworkType, operatingSystem, instanceType, riType, sort)
-			doDisplay(filtered, outputSize)
+			filtered := doFilter(prices, opts)
+			if pivot {
+				doPivot(filtered, outputSize, opts)
+			} else {
+				doDisplay(filtered, outputSize, opts)
+			}
 			return nil
 	}
 	app.Run(os.Args)
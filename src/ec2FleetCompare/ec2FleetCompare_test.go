@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testSpotFeed = `callback({"config": {"regions": [{"region": "us-east-1", "instanceTypes": [{"sizes": [
+	{"size": "m5.large", "valueColumns": [{"name": "linux", "prices": {"USD": "0.035"}}, {"name": "mswin", "prices": {"USD": "0.1"}}]}
+]}]}]}})`
+
+// testFilterOptions are the command line defaults, upper cased the way the action leaves them.
+func testFilterOptions() FilterOptions {
+	return FilterOptions{
+		Region:           "us-east-1",
+		Geography:        "any",
+		Location:         "REGION",
+		InstanceCount:    1,
+		MinInstanceCount: 1,
+		MinCPU:           2,
+		MinMem:           2,
+		MinFleetCPU:      2,
+		MinFleetMem:      2,
+		CpuUtil:          100,
+		CreditMode:       "STANDARD",
+		NetworkBasis:     "BURST",
+		Accelerator:      "ANY",
+		Arch:             "ANY",
+		Vendor:           "ANY",
+		CpuFeatures:      "ANY",
+		DiskType:         "ANY",
+		OperatingSystem:  "LINUX",
+		InstanceType:     "ANY",
+		Category:         "ANY",
+		Tenancy:          "SHARED",
+		License:          "INCLUDED",
+		Software:         "NONE",
+		RIType:           "partial1",
+		Sort:             "demand",
+		MetricModel:      "demand",
+	}
+}
+
+// TestDoFilterFixtures prices a fixture directory the way --fixtures does and filters it.
+func TestDoFilterFixtures(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{"index.json": testOffer(false), "spot.js": testSpotFeed} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var prices Ec2
+	if err := getPrices(&prices, &fixtureSource{dir: dir}, "", "any", 2, "", false, false, false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	where := func(s string) *WhereExpr {
+		w, err := parseWhere(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+	tests := []struct {
+		name string
+		set  func(o *FilterOptions)
+		want map[string]int // instances by type
+	}{
+		{"defaults", func(o *FilterOptions) {}, map[string]int{"m5.large": 1, "m5.2xlarge": 1}},
+		{"fleet sized by vCPUs", func(o *FilterOptions) { o.MinFleetCPU = 8 }, map[string]int{"m5.large": 4, "m5.2xlarge": 1}},
+		{"fixed count", func(o *FilterOptions) { o.InstanceCount = 3; o.MinFleetCPU = 8 }, map[string]int{"m5.large": 3, "m5.2xlarge": 3}},
+		{"windows", func(o *FilterOptions) { o.OperatingSystem = "WINDOWS" }, map[string]int{"m5.large": 1}},
+		{"other region", func(o *FilterOptions) { o.Region = "eu-west-1" }, map[string]int{"m5.large": 1}},
+		{"min cpu", func(o *FilterOptions) { o.MinCPU = 4 }, map[string]int{"m5.2xlarge": 1}},
+		{"where on spot", func(o *FilterOptions) { o.Where = where("spot_hour < 0.1") }, map[string]int{"m5.large": 1}},
+		{"spot ceiling", func(o *FilterOptions) { o.MaxHourly = PriceLimits{"spot": 0.01} }, map[string]int{}},
+	}
+	for _, tt := range tests {
+		opts := testFilterOptions()
+		tt.set(&opts)
+		got := map[string]int{}
+		for _, f := range doFilter(prices, opts) {
+			got[f.Instance.Name] = f.NumberInstances
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// the fleet of four m5.large under every pricing model
+	opts := testFilterOptions()
+	opts.MinFleetCPU = 8
+	for _, f := range doFilter(prices, opts) {
+		if f.Instance.Name != "m5.large" {
+			continue
+		}
+		if f.Binding != "VCPU" || !nearly(f.TotalPriceDemand, 0.096*4*720) || !nearly(f.TotalPriceSpot, 0.035*4*720) ||
+			!nearly(f.TotalPriceRI, 0.02*4*720+300.0/12*4) || !nearly(f.RIUpfront, 1200) || f.TotalPriceSP != 999999999.999999 {
+			t.Errorf("got %+v", f)
+		}
+	}
+}
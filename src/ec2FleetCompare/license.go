@@ -0,0 +1,56 @@
+package main
+
+/*
+Licensed operating systems and pre-installed software (SQL Server Web/Standard/Enterprise ...) are sold as separate
+SKUs of the same instance. The license premium of a SKU is what it costs on top of the base OS price of the same
+instance: the bring your own license SKU where there is one (the price of the box with no license), otherwise
+plain Linux (so RHEL and SUSE show what their subscription adds).
+*/
+
+const byolLicense = "Bring your own license"
+
+// platformKey groups the SKUs of one instance type, region and tenancy.
+func platformKey(i *Instance) string {
+	return i.RegionCode + "|" + i.Tenancy + "|" + i.Name
+}
+
+// computeLicensePremiums sets LicensePremium on every instance, it must run once every OS variant of an instance has its price.
+func computeLicensePremiums(instances map[string]*Instance) {
+	byol := make(map[string]*Instance)
+	linux := make(map[string]*Instance)
+	for _, i := range instances {
+		if i.Specs.Software != "NA" {
+			continue
+		}
+		switch {
+		case i.Specs.License == byolLicense:
+			byol[platformKey(i)+"|"+i.Specs.Os] = i
+		case i.Specs.Os == "Linux":
+			linux[platformKey(i)] = i
+		}
+	}
+
+	for _, i := range instances {
+		base, ok := byol[platformKey(i)+"|"+i.Specs.Os]
+		if !ok {
+			base, ok = linux[platformKey(i)]
+		}
+		if !ok || i.Specs.License == byolLicense {
+			i.LicensePremium = 0
+			continue
+		}
+		i.LicensePremium = i.DemandPrice - base.DemandPrice
+	}
+}
+
+// platform describes the OS, software and license of an instance for display i.e. "Windows SQL Std (BYOL)".
+func (i Instance) platform() string {
+	p := i.Specs.Os
+	if i.Specs.Software != "NA" && i.Specs.Software != "" {
+		p = p + " " + i.Specs.Software
+	}
+	if i.Specs.License == byolLicense {
+		p = p + " (BYOL)"
+	}
+	return p
+}
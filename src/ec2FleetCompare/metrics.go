@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+/*
+Derived metrics put instances of different sizes on the same footing: memory per vCPU, and the hourly price of one
+instance (under the --metric-price pricing model) per vCPU, per GiB, per ECU and per GHz-core (vCPUs times clock
+speed). They are shown with --metrics, can be sorted on and are --where fields. A metric an instance has no figure
+for (no ECU rating, no clock speed, no price under the model) is NaN, shown as N/A and sorted last.
+*/
+
+// metricSorts maps the --sort options that sort on a metric onto it.
+var metricSorts = map[string]func(f Ec2Filtered) float64{
+	"mem-per-vcpu": func(f Ec2Filtered) float64 { return f.MemPerVcpu },
+	"vcpu-hour":    func(f Ec2Filtered) float64 { return f.VcpuHour },
+	"gib-hour":     func(f Ec2Filtered) float64 { return f.GiBHour },
+	"ecu-hour":     func(f Ec2Filtered) float64 { return f.EcuHour },
+	"ghz-hour":     func(f Ec2Filtered) float64 { return f.GHzCoreHour },
+}
+
+// setCompute fills in the ECU rating and clock speed of i from the offer attributes, "Variable" ECUs (burstable
+// types) and missing clock speeds are left at 0.
+func setCompute(i *Instance, attr map[string]string) {
+	i.Specs.Ecu, _ = strconv.ParseFloat(attr["ecu"], 64)
+	if m := r_clock.FindStringSubmatch(i.Specs.CpuClock); m != nil {
+		i.Specs.ClockGHz, _ = strconv.ParseFloat(m[1], 64)
+	}
+}
+
+// per divides price by amount, NaN if either is missing.
+func per(price float64, amount float64) float64 {
+	if amount <= 0 || math.IsNaN(price) {
+		return math.NaN()
+	}
+	return price / amount
+}
+
+// setMetrics computes the derived metrics of f, its prices must be set.
+func (f *Ec2Filtered) setMetrics(model string) {
+	specs := f.Instance.Specs
+	hourly := math.NaN()
+	if p, ok := f.hourlyPrice(model); ok {
+		hourly = p
+	}
+	f.MemPerVcpu = per(specs.Mem, float64(specs.Cpu))
+	f.VcpuHour = per(hourly, float64(specs.Cpu))
+	f.GiBHour = per(hourly, specs.Mem)
+	f.EcuHour = per(hourly, specs.Ecu)
+	f.GHzCoreHour = per(hourly, float64(specs.Cpu)*specs.ClockGHz)
+}
+
+// sortMetric is the SortPrice of a metric sort, missing metrics go last.
+func sortMetric(v float64) float64 {
+	if math.IsNaN(v) {
+		return 999999999.999999
+	}
+	return v
+}
+
+// sortNames lists the --sort options for help and error output: the pricing models, then the metrics and spot
+// history statistics.
+func sortNames() []string {
+	names := append([]string(nil), pricingModels...)
+	var more []string
+	for name := range metricSorts {
+		more = append(more, name)
+	}
+	for name := range historySorts {
+		more = append(more, name)
+	}
+	sort.Strings(more)
+	return append(names, more...)
+}
+
+// validSort reports whether s is a --sort option.
+func validSort(s string) bool {
+	_, model := pricingModelNames[s]
+	_, metric := metricSorts[s]
+	_, history := historySorts[s]
+	return model || metric || history
+}
+
+// sortModel is the pricing model results are priced under for display, the --sort one, spot when sorting on its
+// history or, when sorting on a metric, the --metric-price one.
+func sortModel(opts FilterOptions) string {
+	if _, ok := pricingModelNames[opts.Sort]; ok {
+		return opts.Sort
+	}
+	if _, ok := historySorts[opts.Sort]; ok {
+		return "spot"
+	}
+	if _, ok := pricingModelNames[opts.MetricModel]; ok {
+		return opts.MetricModel
+	}
+	return "demand"
+}
+
+// formatMetric prints a metric with digits decimals, N/A if it is missing.
+func formatMetric(v float64, prefix string, digits int) string {
+	if math.IsNaN(v) {
+		return "N/A"
+	}
+	return prefix + strconv.FormatFloat(v, 'f', digits, 64)
+}
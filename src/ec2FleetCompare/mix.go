@@ -0,0 +1,352 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+)
+
+/*
+The mix optimizer builds a fleet out of several instance types rather than copies of one. It is a small integer
+program: pick counts x for the filtered instances so the fleet meets every fleet target (see fleetResources) and has
+at least --min (and at most --max) instances, uses no more than --maxTypes distinct types and costs the least under the --sort pricing model.
+A fleet runs in one region on one platform (operating system, pre-installed software and license model), so the
+candidates are grouped by those and each group is solved on its own, the cheapest mix of any group wins.
+
+It is solved exactly by branch and bound. Instances beaten on every resource and on price by another are dropped
+first, then types are tried cheapest first with as many instances as could still be useful, pruning any branch whose
+cost plus a lower bound on what is still missing cannot beat the best mix so far. The search gives up after
+mixMaxNodes branches and says so, the mix shown is then the best found.
+
+Dedicated Hosts are billed by the host, not the instance, so they are left out of the mix.
+*/
+
+var mixMaxNodes = 2000000
+
+// mixEpsilon is how much cheaper, in dollars a month, a mix has to be to replace the best so far.
+const mixEpsilon = 0.01
+
+// mixCandidate is one instance that can go into the mix, priced per instance.
+type mixCandidate struct {
+	filtered Ec2Filtered
+	cost     float64   // monthly cost of one instance under the chosen pricing model
+	caps     []float64 // what one instance contributes to each of the needs
+}
+
+type mixItem struct {
+	candidate int
+	count     int
+}
+
+type mixSearch struct {
+	cands    []mixCandidate
+	maxTypes int
+	maxCount int         // most instances the mix may have, 0 for no limit
+	minCost  [][]float64 // minCost[j][d] is the lowest cost per unit of need d among cands[j:]
+
+	cur      []mixItem
+	best     []mixItem
+	bestCost float64
+	found    bool
+	nodes    int
+}
+
+// mixNeeds are the fleet wide totals the mix must reach, every fleetResource then the instance count, in the order
+// of mixCandidate.caps.
+func mixNeeds(opts FilterOptions) []float64 {
+	var needs []float64
+	for _, r := range fleetResources {
+		needs = append(needs, r.need(opts))
+	}
+	return append(needs, float64(opts.MinInstanceCount))
+}
+
+func mixCaps(i Instance, opts FilterOptions) []float64 {
+	var caps []float64
+	for _, r := range fleetResources {
+		caps = append(caps, r.has(i, opts))
+	}
+	return append(caps, 1)
+}
+
+// mixGroup is the region and platform of i, the instances of a fleet all share them.
+func mixGroup(i Instance) string {
+	return i.RegionCode + "|" + i.Specs.Os + "|" + i.Specs.Software + "|" + i.Specs.License
+}
+
+// mixCandidates prices every filtered instance on its own and groups them by mixGroup, see mixPrune.
+func mixCandidates(ec2 Ec2, opts FilterOptions) map[string][]mixCandidate {
+	groups := make(map[string][]mixCandidate)
+	for _, f := range doFilter(ec2, withoutFleetTargets(opts)) {
+		if f.Instance.Host != nil {
+			continue
+		}
+		cost, ok := f.monthlyPrice(opts.Sort)
+		if !ok || cost <= 0 {
+			continue
+		}
+		group := mixGroup(f.Instance)
+		groups[group] = append(groups[group], mixCandidate{filtered: f, cost: cost, caps: mixCaps(f.Instance, opts)})
+	}
+	for group, all := range groups {
+		groups[group] = mixPrune(all)
+	}
+	return groups
+}
+
+// mixPrune sorts the candidates of a group cheapest first, keeping only those that are not beaten on every resource
+// and on price by another.
+func mixPrune(all []mixCandidate) []mixCandidate {
+	sort.SliceStable(all, func(a, b int) bool {
+		if all[a].cost != all[b].cost {
+			return all[a].cost < all[b].cost
+		}
+		return all[a].filtered.Instance.Sku < all[b].filtered.Instance.Sku
+	})
+
+	var kept []mixCandidate
+	for j, c := range all {
+		dominated := false
+		for i, o := range all {
+			if i == j || o.cost > c.cost {
+				continue
+			}
+			covers, better := true, o.cost < c.cost
+			for d := range c.caps {
+				if o.caps[d] < c.caps[d] {
+					covers = false
+					break
+				}
+				if o.caps[d] > c.caps[d] {
+					better = true
+				}
+			}
+			// of two identical candidates keep the first
+			if covers && (better || i < j) {
+				dominated = true
+				break
+			}
+		}
+		if !dominated {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// mixSolve finds the cheapest fleet of a single type among cands and the cheapest mix of at most maxTypes of them,
+// which starts from the single type fleet so it only wins if it is cheaper.
+func mixSolve(cands []mixCandidate, needs []float64, maxTypes int, maxCount int) (*mixSearch, *mixSearch) {
+	single := newMixSearch(cands, len(needs), 1)
+	single.maxCount = maxCount
+	single.search(0, needs, 0, 0)
+
+	m := newMixSearch(cands, len(needs), maxTypes)
+	m.maxCount = maxCount
+	if single.found {
+		m.best, m.bestCost, m.found = append([]mixItem(nil), single.best...), single.bestCost, true
+	}
+	m.search(0, needs, 0, 0)
+	return single, m
+}
+
+func newMixSearch(cands []mixCandidate, numNeeds int, maxTypes int) *mixSearch {
+	m := &mixSearch{cands: cands, maxTypes: maxTypes, bestCost: math.Inf(1)}
+	m.minCost = make([][]float64, len(cands)+1)
+	m.minCost[len(cands)] = make([]float64, numNeeds)
+	for d := range m.minCost[len(cands)] {
+		m.minCost[len(cands)][d] = math.Inf(1)
+	}
+	for j := len(cands) - 1; j >= 0; j-- {
+		m.minCost[j] = make([]float64, numNeeds)
+		for d := range m.minCost[j] {
+			m.minCost[j][d] = m.minCost[j+1][d]
+			if cands[j].caps[d] > 0 && cands[j].cost/cands[j].caps[d] < m.minCost[j][d] {
+				m.minCost[j][d] = cands[j].cost / cands[j].caps[d]
+			}
+		}
+	}
+	return m
+}
+
+// bound is a lower bound on the cost of covering rem with cands[start:], each need on its own has to be paid for at
+// the best rate available.
+func (m *mixSearch) bound(start int, rem []float64) float64 {
+	var b float64
+	for d, r := range rem {
+		if r > 0 && r*m.minCost[start][d] > b {
+			b = r * m.minCost[start][d]
+		}
+	}
+	return b
+}
+
+// useful is the most instances of c worth adding, beyond it every remaining need is already met.
+func useful(c mixCandidate, rem []float64) int {
+	n := 0
+	for d, r := range rem {
+		if r > 0 && c.caps[d] > 0 {
+			if k := int(math.Ceil(r / c.caps[d])); k > n {
+				n = k
+			}
+		}
+	}
+	return n
+}
+
+func (m *mixSearch) search(start int, rem []float64, cost float64, count int) {
+	m.nodes++
+	done := true
+	for _, r := range rem {
+		if r > 0 {
+			done = false
+		}
+	}
+	if done {
+		if cost < m.bestCost-mixEpsilon {
+			m.bestCost = cost
+			m.best = append(m.best[:0], m.cur...)
+			m.found = true
+		}
+		return
+	}
+	if len(m.cur) == m.maxTypes || m.nodes > mixMaxNodes || cost+m.bound(start, rem) >= m.bestCost {
+		return
+	}
+
+	next := make([]float64, len(rem))
+	for j := start; j < len(m.cands); j++ {
+		c := m.cands[j]
+		most := useful(c, rem)
+		least := 1
+		if len(m.cur)+1 == m.maxTypes {
+			// the last type allowed has to finish the fleet on its own
+			least = most
+		}
+		for x := most; x >= least && x > 0; x-- {
+			if cost+float64(x)*c.cost >= m.bestCost || (m.maxCount > 0 && count+x > m.maxCount) {
+				continue
+			}
+			for d := range rem {
+				next[d] = rem[d] - float64(x)*c.caps[d]
+			}
+			if x < most && cost+float64(x)*c.cost+m.bound(j+1, next) >= m.bestCost {
+				continue
+			}
+			m.cur = append(m.cur, mixItem{candidate: j, count: x})
+			m.search(j+1, next, cost+float64(x)*c.cost, count+x)
+			m.cur = m.cur[:len(m.cur)-1]
+			if m.nodes > mixMaxNodes {
+				return
+			}
+		}
+	}
+}
+
+/*
+doMix finds and displays the cheapest mix of the filtered instances covering the fleet needs under the --sort pricing
+model, next to the cheapest fleet made of a single type for comparison.
+*/
+func doMix(ec2 Ec2, opts FilterOptions, maxTypes int) error {
+	if maxTypes < 1 {
+		return fmt.Errorf("maxTypes must be at least 1, got %d", maxTypes)
+	}
+	opts.Sort = sortModel(opts)
+	needs := mixNeeds(opts)
+	groups := mixCandidates(ec2, opts)
+	if len(groups) == 0 {
+		return fmt.Errorf("No instances match the filters with a %s price", opts.Sort)
+	}
+	keys := make([]string, 0, len(groups))
+	for group := range groups {
+		keys = append(keys, group)
+	}
+	sort.Strings(keys)
+
+	var cands, singleCands []mixCandidate
+	var m, single *mixSearch
+	stopped := false
+	for _, group := range keys {
+		s, g := mixSolve(groups[group], needs, maxTypes, opts.MaxInstanceCount)
+		stopped = stopped || s.nodes > mixMaxNodes || g.nodes > mixMaxNodes
+		if g.found && (m == nil || g.bestCost < m.bestCost) {
+			cands, m = groups[group], g
+		}
+		if s.found && (single == nil || s.bestCost < single.bestCost) {
+			singleCands, single = groups[group], s
+		}
+	}
+
+	if m == nil {
+		return fmt.Errorf("No mix of at most %d instance types meets the fleet requirements", maxTypes)
+	}
+	// the mix is only priced under the --sort model, so only its ceiling can be held to
+	if limit, ok := opts.MaxMonthly[opts.Sort]; ok && m.bestCost > limit {
+		return fmt.Errorf("The cheapest mix costs $%s/month, over the --max-monthly of $%s", humanize.Comma(int64(m.bestCost)), humanize.Comma(int64(limit)))
+	}
+
+	// vCPU and memory are always shown, the other resources once a target is set for them
+	var shown []int
+	for d := range fleetResources {
+		if d < 2 || needs[d] > 0 {
+			shown = append(shown, d)
+		}
+	}
+
+	var data [][]string
+	totals := make([]float64, len(needs))
+	for _, item := range m.best {
+		c := cands[item.candidate]
+		for d := range totals {
+			totals[d] += float64(item.count) * c.caps[d]
+		}
+		result := []string{strconv.Itoa(item.count), c.filtered.Instance.Name}
+		for _, d := range shown {
+			result = append(result, formatResource(c.caps[d]))
+		}
+		result = append(result, "$"+humanize.Comma(int64(c.cost)), "$"+humanize.Comma(int64(c.cost*float64(item.count))))
+		data = append(data, result)
+	}
+
+	model := pricingModelNames[opts.Sort]
+	header := []string{"# Inst", "Type"}
+	footer := []string{strconv.Itoa(int(totals[len(totals)-1])), "Total"}
+	for _, d := range shown {
+		header = append(header, fleetResources[d].Name)
+		footer = append(footer, formatResource(totals[d]))
+	}
+	header = append(header, model+"/Mon ea", model+"/Mon")
+	footer = append(footer, "", "$"+humanize.Comma(int64(m.bestCost)))
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(header)
+	table.SetFooter(footer)
+	table.SetBorder(true)
+	table.AppendBulk(data)
+	table.Render()
+
+	if len(groups) > 1 {
+		i := cands[0].filtered.Instance
+		fmt.Printf("Mixed in %s on %s, the cheapest of %d region and platform combinations\n", i.RegionCode, i.platform(), len(groups))
+	}
+	if single != nil {
+		c := singleCands[single.best[0].candidate]
+		fmt.Printf("Cheapest single type fleet: %d x %s in %s at $%s/month\n", single.best[0].count, c.filtered.Instance.Name, c.filtered.Instance.RegionCode, humanize.Comma(int64(single.bestCost)))
+	}
+	if stopped {
+		fmt.Printf("Search stopped after %d combinations, the mix shown is the best found\n", mixMaxNodes)
+	}
+	return nil
+}
+
+// formatResource prints a resource amount, whole numbers without decimals.
+func formatResource(v float64) string {
+	if v == math.Trunc(v) {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
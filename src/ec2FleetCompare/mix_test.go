@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mixBrute is the cheapest mix by trying every count of every candidate up to the most that could be useful.
+func mixBrute(cands []mixCandidate, needs []float64, maxTypes int, maxCount int) (float64, bool) {
+	best := math.Inf(1)
+	var try func(j int, rem []float64, cost float64, types int, count int)
+	try = func(j int, rem []float64, cost float64, types int, count int) {
+		if j == len(cands) {
+			for _, r := range rem {
+				if r > 0 {
+					return
+				}
+			}
+			best = math.Min(best, cost)
+			return
+		}
+		try(j+1, rem, cost, types, count)
+		if types == maxTypes {
+			return
+		}
+		for x := 1; x <= useful(cands[j], needs); x++ {
+			if maxCount > 0 && count+x > maxCount {
+				break
+			}
+			next := make([]float64, len(rem))
+			for d := range rem {
+				next[d] = rem[d] - float64(x)*cands[j].caps[d]
+			}
+			try(j+1, next, cost+float64(x)*cands[j].cost, types+1, count+x)
+		}
+	}
+	try(0, needs, 0, 0, 0)
+	return best, !math.IsInf(best, 1)
+}
+
+// mixCost checks items cover needs within maxTypes and maxCount and returns what they cost.
+func mixCost(t *testing.T, cands []mixCandidate, items []mixItem, needs []float64, maxTypes int, maxCount int) float64 {
+	t.Helper()
+	rem := append([]float64(nil), needs...)
+	var cost float64
+	var count int
+	for _, item := range items {
+		for d := range rem {
+			rem[d] -= float64(item.count) * cands[item.candidate].caps[d]
+		}
+		cost += float64(item.count) * cands[item.candidate].cost
+		count += item.count
+	}
+	for d, r := range rem {
+		if r > 0 {
+			t.Errorf("mix %v is %v short of need %d", items, r, d)
+		}
+	}
+	if len(items) > maxTypes || (maxCount > 0 && count > maxCount) {
+		t.Errorf("mix %v has more than %d types or %d instances", items, maxTypes, maxCount)
+	}
+	return cost
+}
+
+func TestMixSolve(t *testing.T) {
+	cand := func(cost float64, caps ...float64) mixCandidate { return mixCandidate{cost: cost, caps: caps} }
+	tests := []struct {
+		name     string
+		cands    []mixCandidate
+		needs    []float64
+		maxTypes int
+		maxCount int
+		single   float64
+		mix      float64 // 0 if there is none
+	}{
+		{"two types cover each other's gaps", []mixCandidate{cand(10, 4, 1), cand(10, 1, 4)}, []float64{8, 8}, 2, 0, 80, 40},
+		{"one type allowed", []mixCandidate{cand(10, 4, 1), cand(10, 1, 4)}, []float64{8, 8}, 1, 0, 80, 80},
+		{"small cheap type", []mixCandidate{cand(2, 1, 1), cand(12, 4, 4)}, []float64{8, 8}, 2, 0, 16, 16},
+		{"instance count ceiling", []mixCandidate{cand(2, 1, 1), cand(12, 4, 4)}, []float64{8, 8}, 2, 4, 24, 24},
+		{"topped up with a cheaper type", []mixCandidate{cand(3, 1, 1), cand(9, 4, 4)}, []float64{9, 9}, 2, 0, 27, 21},
+		{"nothing fits under the ceiling", []mixCandidate{cand(2, 1, 1), cand(12, 4, 4)}, []float64{8, 8}, 2, 1, 0, 0},
+	}
+	for _, tt := range tests {
+		cands := mixPrune(tt.cands)
+		single, m := mixSolve(cands, tt.needs, tt.maxTypes, tt.maxCount)
+		if (tt.mix > 0) != m.found || (m.found && math.Abs(m.bestCost-tt.mix) > mixEpsilon) {
+			t.Errorf("%s: mix %v %v, want %v", tt.name, m.found, m.bestCost, tt.mix)
+		}
+		if (tt.single > 0) != single.found || (single.found && math.Abs(single.bestCost-tt.single) > mixEpsilon) {
+			t.Errorf("%s: single %v %v, want %v", tt.name, single.found, single.bestCost, tt.single)
+		}
+		if m.found && math.Abs(mixCost(t, cands, m.best, tt.needs, tt.maxTypes, tt.maxCount)-m.bestCost) > 1e-9 {
+			t.Errorf("%s: mix %v doesn't cost %v", tt.name, m.best, m.bestCost)
+		}
+	}
+}
+
+// TestMixSolveBrute checks the branch and bound search, its pruning included, against trying every mix.
+func TestMixSolveBrute(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 300; n++ {
+		var cands []mixCandidate
+		for c := 1 + r.Intn(5); c > 0; c-- {
+			// vCPUs, memory and the instance count, as mixCaps lays them out
+			cands = append(cands, mixCandidate{cost: float64(1 + r.Intn(40)), caps: []float64{float64(r.Intn(9)), float64(r.Intn(17)), 1}})
+		}
+		needs := []float64{float64(r.Intn(25)), float64(r.Intn(40)), float64(1 + r.Intn(3))}
+		maxTypes := 1 + r.Intn(3)
+		maxCount := 0
+		if r.Intn(2) == 0 {
+			maxCount = 2 + r.Intn(12)
+		}
+
+		want, ok := mixBrute(cands, needs, maxTypes, maxCount)
+		pruned := mixPrune(append([]mixCandidate(nil), cands...))
+		_, m := mixSolve(pruned, needs, maxTypes, maxCount)
+		if m.found != ok || (ok && math.Abs(m.bestCost-want) > mixEpsilon) {
+			var desc []string
+			for _, c := range cands {
+				desc = append(desc, fmt.Sprintf("$%v %v", c.cost, c.caps))
+			}
+			t.Fatalf("%v needs %v, %d types, %d instances: got %v %v, want %v %v", desc, needs, maxTypes, maxCount, m.bestCost, m.found, want, ok)
+		}
+		if m.found {
+			mixCost(t, pruned, m.best, needs, maxTypes, maxCount)
+		}
+	}
+}
+
+func TestMixPrune(t *testing.T) {
+	cand := func(sku string, cost float64, caps ...float64) mixCandidate {
+		return mixCandidate{filtered: Ec2Filtered{Instance: Instance{Sku: sku}}, cost: cost, caps: caps}
+	}
+	kept := mixPrune([]mixCandidate{
+		cand("dearer", 20, 4, 8),
+		cand("covers", 10, 4, 8),
+		cand("twin", 10, 4, 8),
+		cand("smaller", 10, 2, 8),
+		cand("cheap", 5, 2, 2),
+		cand("more memory", 12, 2, 16),
+	})
+	var skus []string
+	for _, c := range kept {
+		skus = append(skus, c.filtered.Instance.Sku)
+	}
+	want := []string{"cheap", "covers", "more memory"}
+	if !reflect.DeepEqual(skus, want) {
+		t.Errorf("got %v, want %v", skus, want)
+	}
+}
+
+func TestMixCandidatesGroups(t *testing.T) {
+	var ec2 Ec2
+	if err := parseOffer(strings.NewReader(testOffer(false)), &ec2, newOfferFilter(""), 1); err != nil {
+		t.Fatal(err)
+	}
+	opts := testFilterOptions()
+	opts.Region = ""
+	opts.OperatingSystem = "ANY"
+	got := map[string]int{}
+	for group, cands := range mixCandidates(ec2, opts) {
+		got[group] = len(cands)
+	}
+	want := map[string]int{
+		"us-east-1|Linux|NA|No License required":   2,
+		"us-east-1|Windows|NA|No License required": 1,
+		"eu-west-1|Linux|NA|No License required":   1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
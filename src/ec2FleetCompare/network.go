@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+networkPerformance comes as a figure ("10 Gigabit", "4x 100 Gigabit"), a burstable figure ("Up to 25 Gigabit") or,
+on older generations, a label ("Low", "Moderate", "High"). Each is turned into a baseline and a burst rate in Gbps.
+
+The offer file does not give the baseline of an "Up to" instance. It scales with the size of the instance, which is
+taken as its share of a 32 vCPU instance (the size at which "Up to 10 Gigabit" families reach their full rate), so it
+is an estimate. The labels are rough figures from the published baselines of the instances that carry them.
+*/
+
+var r_network = regexp.MustCompile(`(?i)^\s*(up to\s+)?(?:(\d+)\s*x\s*)?(\d+(?:\.\d+)?)\s*gigabit`)
+
+var networkLabels = map[string]float64{
+	"very low":        0.05,
+	"low":             0.1,
+	"low to moderate": 0.3,
+	"moderate":        0.5,
+	"high":            1,
+}
+
+// networkAliases maps the named --network options kept from before it took Gbps onto a minimum Gbps.
+var networkAliases = map[string]float64{
+	"any":      0,
+	"low":      0,
+	"med":      networkLabels["moderate"],
+	"medium":   networkLabels["moderate"],
+	"moderate": networkLabels["moderate"],
+	"high":     networkLabels["high"],
+	"gbit":     10,
+}
+
+// setNetwork fills in the network specs of i from its networkPerformance.
+func setNetwork(i *Instance) {
+	desc := i.Specs.NetworkDesc
+	if m := r_network.FindStringSubmatch(desc); m != nil {
+		gbps, _ := strconv.ParseFloat(m[3], 64)
+		if m[2] != "" {
+			links, _ := strconv.ParseFloat(m[2], 64)
+			gbps *= links
+		}
+		i.Specs.NetworkBurstGbps = gbps
+		i.Specs.NetworkBaselineGbps = gbps
+		if m[1] != "" && i.Specs.Cpu > 0 {
+			i.Specs.NetworkBaselineGbps = math.Min(gbps, gbps*float64(i.Specs.Cpu)/32)
+		}
+		return
+	}
+	gbps := networkLabels[strings.ToLower(strings.TrimSpace(desc))]
+	i.Specs.NetworkBurstGbps = gbps
+	i.Specs.NetworkBaselineGbps = gbps
+}
+
+// parseNetwork reads the --network option, a number of Gbps or one of networkAliases.
+func parseNetwork(network string) (float64, error) {
+	if gbps, ok := networkAliases[strings.ToLower(network)]; ok {
+		return gbps, nil
+	}
+	gbps, err := strconv.ParseFloat(network, 64)
+	if err != nil || gbps < 0 {
+		return 0, fmt.Errorf("Unknown network %q, options: a number of Gbps i.e 25, or low, medium, high, gbit", network)
+	}
+	return gbps, nil
+}
+
+// networkGbps is the rate of s compared against --network, its burst or its baseline rate.
+func (s InstanceSpecs) networkGbps(basis string) float64 {
+	if basis == "BASELINE" {
+		return s.NetworkBaselineGbps
+	}
+	return s.NetworkBurstGbps
+}
@@ -0,0 +1,75 @@
+package main
+
+import "testing"
+
+func TestNetworkPattern(t *testing.T) {
+	tests := []struct {
+		in               string
+		upTo, links, num string
+	}{
+		{"10 Gigabit", "", "", "10"},
+		{"Up to 25 Gigabit", "Up to ", "", "25"},
+		{"4x 100 Gigabit", "", "4", "100"},
+		{"8 x 400 Gigabit", "", "8", "400"},
+		{"12.5 gigabit", "", "", "12.5"},
+	}
+	for _, tt := range tests {
+		m := r_network.FindStringSubmatch(tt.in)
+		if m == nil || m[1] != tt.upTo || m[2] != tt.links || m[3] != tt.num {
+			t.Errorf("%q: got %q", tt.in, m)
+		}
+	}
+	for _, in := range []string{"High", "Moderate", "NA", ""} {
+		if m := r_network.FindStringSubmatch(in); m != nil {
+			t.Errorf("%q: got %q, want no match", in, m)
+		}
+	}
+}
+
+func TestSetNetwork(t *testing.T) {
+	tests := []struct {
+		desc     string
+		cpu      int
+		baseline float64
+		burst    float64
+	}{
+		{"10 Gigabit", 16, 10, 10},
+		{"Up to 25 Gigabit", 16, 12.5, 25},
+		{"Up to 10 Gigabit", 2, 0.625, 10},
+		{"Up to 10 Gigabit", 64, 10, 10},
+		{"4x 100 Gigabit", 192, 400, 400},
+		{"High", 8, 1, 1},
+		{"low to moderate", 2, 0.3, 0.3},
+		{"NA", 2, 0, 0},
+	}
+	for _, tt := range tests {
+		i := Instance{Specs: InstanceSpecs{Cpu: tt.cpu, NetworkDesc: tt.desc}}
+		setNetwork(&i)
+		if i.Specs.NetworkBaselineGbps != tt.baseline || i.Specs.NetworkBurstGbps != tt.burst {
+			t.Errorf("%q on %d vCPUs: got %v/%v, want %v/%v", tt.desc, tt.cpu, i.Specs.NetworkBaselineGbps, i.Specs.NetworkBurstGbps, tt.baseline, tt.burst)
+		}
+	}
+}
+
+func TestParseNetwork(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"any", 0, true},
+		{"Medium", 0.5, true},
+		{"high", 1, true},
+		{"gbit", 10, true},
+		{"25", 25, true},
+		{"0.5", 0.5, true},
+		{"-1", 0, false},
+		{"fast", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseNetwork(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("%q: got %v %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+The EC2 offer file is several gigabytes of JSON shaped like
+
+	{ "formatVersion": ..., "products": { "<sku>": {...}, ... }, "terms": { "OnDemand": { "<sku>": {...} }, "Reserved": {...} } }
+
+Rather than decoding all of it into memory the parser below walks the document with json.Decoder tokens, decodes a
+single product or a single SKU's terms at a time and throws away everything that can never be displayed as soon as it
+arrives. Peak memory is therefore bounded by the instances we keep, not by the size of the file.
+*/
+
+// offerProduct is one entry of the "products" object.
+type offerProduct struct {
+	Sku           string            `json:"sku"`
+	ProductFamily string            `json:"productFamily"`
+	Attributes    map[string]string `json:"attributes"`
+}
+
+// offerTerm is one offer (keyed by <sku>.<offerTermCode>) of a SKU within the "terms" object.
+type offerTerm struct {
+	OfferTermCode   string                    `json:"offerTermCode"`
+	PriceDimensions map[string]offerDimension `json:"priceDimensions"`
+	TermAttributes  map[string]string         `json:"termAttributes"`
+}
+
+type offerDimension struct {
+	Unit         string            `json:"unit"`
+	PricePerUnit map[string]string `json:"pricePerUnit"`
+}
+
+// offerFilter decides which SKUs are worth keeping while the offer file streams past.
+type offerFilter struct {
+	regions *regexp.Regexp // nil keeps every region
+	region  string         // set when parsing the offer file of a single region
+}
+
+// newOfferFilter builds a filter matching regions the same way doFilter does.
+func newOfferFilter(region string) offerFilter {
+	var f offerFilter
+	if region != "" {
+		f.regions = regexp.MustCompile(`(?i).*` + region + `.*`)
+	}
+	return f
+}
+
+type offerParser struct {
+	filter  offerFilter
+	workers int
+
+	mu        sync.Mutex
+	instances map[string]*Instance // every kept SKU, Dedicated Hosts included until combineHosts
+	hosts     map[string]bool      // SKUs of the Dedicated Host products in instances
+	regions   map[string]Region    // every location seen on a kept SKU
+
+	productsDone bool
+	pending      map[string]map[string]map[string]offerTerm // termType -> sku -> terms, only if terms precede products
+}
+
+var r_mem = regexp.MustCompile(`(\d+)(?:(\.\d+))*\s+GiB`)
+var r_clock = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*GHz`)
+
+func downloadDemandPrices(src PriceSource, location string, ec2 *Ec2, filter offerFilter, workers int) error {
+	body, err := src.Open(location)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	return parseOffer(body, ec2, filter, workers)
+}
+
+// parseOffer streams an offer file from r and appends every instance that passes filter to ec2.
+func parseOffer(r io.Reader, ec2 *Ec2, filter offerFilter, workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &offerParser{
+		filter:    filter,
+		workers:   workers,
+		instances: make(map[string]*Instance),
+		hosts:     make(map[string]bool),
+		regions:   make(map[string]Region),
+	}
+
+	dec := json.NewDecoder(bufio.NewReaderSize(r, 1<<20))
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		key, err := nextKey(dec)
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "products":
+			err = p.parseProducts(dec)
+		case "terms":
+			err = p.parseTerms(dec)
+		default:
+			err = skipValue(dec)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return err
+	}
+
+	for termType, skus := range p.pending {
+		for sku, terms := range skus {
+			if i, ok := p.instances[sku]; ok {
+				applyTerms(i, termType, terms)
+			}
+		}
+	}
+
+	combineHosts(p.instances, p.hosts)
+	computeLicensePremiums(p.instances)
+
+	// emit in SKU order so repeated runs (and the cache) are stable
+	skus := make([]string, 0, len(p.instances))
+	for sku := range p.instances {
+		skus = append(skus, sku)
+	}
+	sort.Strings(skus)
+	for _, sku := range skus {
+		ec2.Instance = append(ec2.Instance, *p.instances[sku])
+	}
+	ec2.addRegions(p.regions)
+	return nil
+}
+
+// parseProducts hands each raw product to the worker pool, only products that make it through productToInstance are kept.
+func (p *offerParser) parseProducts(dec *json.Decoder) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	err := p.pool(dec, func(sku string, raw json.RawMessage) error {
+		var product offerProduct
+		if err := json.Unmarshal(raw, &product); err != nil {
+			return err
+		}
+		if product.Sku == "" {
+			product.Sku = sku
+		}
+		i, ok := p.productToInstance(product)
+		if !ok {
+			return nil
+		}
+		p.mu.Lock()
+		p.instances[i.Sku] = i
+		if product.ProductFamily == "Dedicated Host" {
+			p.hosts[i.Sku] = true
+		}
+		if _, ok := p.regions[i.RegionCode]; !ok {
+			p.regions[i.RegionCode] = newRegion(i.RegionCode, i.RegionName, product.Attributes["locationType"])
+		}
+		p.mu.Unlock()
+		return nil
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	p.productsDone = true
+	return expectDelim(dec, '}')
+}
+
+// parseTerms walks terms.<termType>.<sku>, terms of SKUs we dropped are skipped token by token without being decoded.
+func (p *offerParser) parseTerms(dec *json.Decoder) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		termType, err := nextKey(dec)
+		if err != nil {
+			return err
+		}
+		if err := expectDelim(dec, '{'); err != nil {
+			return err
+		}
+
+		wanted := func(sku string) bool {
+			if !p.productsDone {
+				return true
+			}
+			_, ok := p.instances[sku]
+			return ok
+		}
+		err = p.pool(dec, func(sku string, raw json.RawMessage) error {
+			var terms map[string]offerTerm
+			if err := json.Unmarshal(raw, &terms); err != nil {
+				return err
+			}
+			if !p.productsDone {
+				// products normally come first, if they didn't keep the (already small) parsed terms until they do
+				p.mu.Lock()
+				if p.pending == nil {
+					p.pending = make(map[string]map[string]map[string]offerTerm)
+				}
+				if p.pending[termType] == nil {
+					p.pending[termType] = make(map[string]map[string]offerTerm)
+				}
+				p.pending[termType][sku] = terms
+				p.mu.Unlock()
+				return nil
+			}
+			// every SKU appears once per term type so workers never touch the same instance concurrently
+			applyTerms(p.instances[sku], termType, terms)
+			return nil
+		}, wanted)
+		if err != nil {
+			return err
+		}
+
+		if err := expectDelim(dec, '}'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+// pool reads "<sku>": <value> pairs from dec until the enclosing object ends and runs fn over the raw values on
+// p.workers goroutines. When wanted is set, values whose SKU it rejects are skipped without being buffered.
+func (p *offerParser) pool(dec *json.Decoder, fn func(sku string, raw json.RawMessage) error, wanted func(sku string) bool) error {
+	type job struct {
+		sku string
+		raw json.RawMessage
+	}
+
+	jobs := make(chan job, p.workers*4)
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	for w := 0; w < p.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if err := fn(j.sku, j.raw); err != nil {
+					errOnce.Do(func() { firstErr = err })
+				}
+			}
+		}()
+	}
+
+	var err error
+	for dec.More() {
+		var sku string
+		if sku, err = nextKey(dec); err != nil {
+			break
+		}
+		if wanted != nil && !wanted(sku) {
+			if err = skipValue(dec); err != nil {
+				break
+			}
+			continue
+		}
+		var raw json.RawMessage
+		if err = dec.Decode(&raw); err != nil {
+			break
+		}
+		jobs <- job{sku, raw}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err != nil {
+		return err
+	}
+	return firstErr
+}
+
+// productToInstance turns a product into an Instance, the bool is false for products we are not interested in.
+func (p *offerParser) productToInstance(product offerProduct) (*Instance, bool) {
+	attr := product.Attributes
+
+	// make sure this is actually a EC2 server JSON object, or the host Host tenancy instances are priced by
+	host := product.ProductFamily == "Dedicated Host"
+	if product.ProductFamily != "Compute Instance" && !host {
+		return nil, false
+	}
+
+	// just process all but unknown OS, hosts have none
+	os, ok := attr["operatingSystem"]
+	if !host && (!ok || os == "NA") {
+		return nil, false
+	}
+
+	// keep shared, dedicated instance and dedicated host tenancy
+	tenancy := attr["tenancy"]
+	if tenancy != "Shared" && tenancy != "Dedicated" && tenancy != "Host" {
+		return nil, false
+	}
+
+	// capacity reservation SKUs repeat every instance with a zero price, only the "Used" one is the real thing
+	if status, ok := attr["capacitystatus"]; ok && status != "Used" {
+		return nil, false
+	}
+
+	var i Instance
+	i.Name = attr["instanceType"]
+	i.RegionName = attr["location"]
+	i.RegionCode = attr["regionCode"]
+	if p.filter.region != "" {
+		// older per-region files carry no regionCode, everything in them is in that region anyway
+		if i.RegionCode == "" {
+			i.RegionCode = p.filter.region
+		}
+		// the region's own file also lists its Local and Wavelength Zones i.e. us-east-1-bos-1
+		if i.RegionCode != p.filter.region && !strings.HasPrefix(i.RegionCode, p.filter.region+"-") {
+			return nil, false
+		}
+	}
+	if i.RegionCode == "" {
+		return nil, false
+	}
+	if p.filter.regions != nil && !p.filter.regions.MatchString(i.RegionCode) {
+		return nil, false
+	}
+
+	i.Sku = product.Sku
+	i.UsageType = attr["usagetype"]
+	i.Operation = attr["operation"]
+	i.Tenancy = tenancy
+	i.Specs.Cpu, _ = strconv.Atoi(attr["vcpu"])
+	i.Specs.CpuClock = attr["clockSpeed"]
+	i.Specs.NetworkDesc = attr["networkPerformance"]
+	if !host {
+		i.Specs.Os = os
+		i.Specs.License = attr["licenseModel"]
+		i.Specs.Software = attr["preInstalledSw"]
+		if i.Specs.Software == "" {
+			i.Specs.Software = "NA"
+		}
+	}
+
+	mem := r_mem.FindStringSubmatch(attr["memory"])
+	if len(mem) >= 2 {
+		i.Specs.Mem, _ = strconv.ParseFloat(mem[1]+mem[2], 64)
+	} else {
+		i.Specs.Mem = 0 // basically could not match memory
+	}
+
+	setNetwork(&i)
+	setAccelerators(&i, attr)
+	setProcessor(&i, attr)
+	setCategory(&i, attr)
+	setCompute(&i, attr)
+	setBurstable(&i)
+
+	setStorage(&i, attr["storage"])
+
+	// set fake spot price which should get over-set
+	i.SpotPrice = 999999.9
+
+	return &i, true
+}
+
+// nextKey reads an object key.
+func nextKey(dec *json.Decoder) (string, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return "", err
+	}
+	key, ok := t.(string)
+	if !ok {
+		return "", errors.New("Malformed offer file: expected an object key")
+	}
+	return key, nil
+}
+
+// expectDelim reads a token and checks it is the delimiter d.
+func expectDelim(dec *json.Decoder, d json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if got, ok := t.(json.Delim); !ok || got != d {
+		return errors.New("Malformed offer file: expected " + d.String())
+	}
+	return nil
+}
+
+// skipValue consumes the next value token by token, so large sections we do not need are never held in memory.
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if d, ok := t.(json.Delim); ok {
+			switch d {
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
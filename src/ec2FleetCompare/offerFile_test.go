@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testProduct is a Compute Instance product of the test offer.
+func testProduct(sku string, name string, region string, os string, vcpu string, mem string) offerProduct {
+	return offerProduct{Sku: sku, ProductFamily: "Compute Instance", Attributes: map[string]string{
+		"instanceType":       name,
+		"regionCode":         region,
+		"location":           region,
+		"locationType":       "AWS Region",
+		"operatingSystem":    os,
+		"licenseModel":       "No License required",
+		"preInstalledSw":     "NA",
+		"tenancy":            "Shared",
+		"capacitystatus":     "Used",
+		"vcpu":               vcpu,
+		"memory":             mem,
+		"storage":            "EBS only",
+		"networkPerformance": "Up to 10 Gigabit",
+	}}
+}
+
+// testTerm is an offer term of one hourly and, if upfront isn't empty, one upfront price.
+func testTerm(hourly string, upfront string, attributes map[string]string) map[string]offerTerm {
+	dimensions := map[string]offerDimension{"H": {Unit: "Hrs", PricePerUnit: map[string]string{"USD": hourly}}}
+	if upfront != "" {
+		dimensions["Q"] = offerDimension{Unit: "Quantity", PricePerUnit: map[string]string{"USD": upfront}}
+	}
+	return map[string]offerTerm{"T": {PriceDimensions: dimensions, TermAttributes: attributes}}
+}
+
+// testOffer is a small offer file, its terms before or after its products.
+func testOffer(termsFirst bool) string {
+	unused := testProduct("E", "m5.large", "us-east-1", "Linux", "2", "8 GiB")
+	unused.Attributes["capacitystatus"] = "UnusedCapacityReservation"
+	products := map[string]offerProduct{
+		"A": testProduct("A", "m5.large", "us-east-1", "Linux", "2", "8 GiB"),
+		"B": testProduct("B", "m5.2xlarge", "us-east-1", "Linux", "8", "32 GiB"),
+		"C": testProduct("C", "m5.large", "us-east-1", "Windows", "2", "8 GiB"),
+		"D": testProduct("D", "m5.large", "eu-west-1", "Linux", "2", "8 GiB"),
+		"E": unused,
+		"F": {Sku: "F", ProductFamily: "Storage", Attributes: map[string]string{"regionCode": "us-east-1"}},
+	}
+	terms := map[string]map[string]map[string]offerTerm{
+		"OnDemand": {
+			"A": testTerm("0.096", "", nil),
+			"B": testTerm("0.384", "", nil),
+			"C": testTerm("0.188", "", nil),
+			"D": testTerm("0.107", "", nil),
+			"E": testTerm("0", "", nil),
+			"Z": testTerm("1", "", nil), // a product that isn't there
+		},
+		"Reserved": {
+			"A": {
+				"P": testTerm("0.02", "300", map[string]string{"LeaseContractLength": "1yr", "PurchaseOption": "Partial Upfront", "OfferingClass": "standard"})["T"],
+				"L": testTerm("0.05", "", map[string]string{"PurchaseOption": "Heavy Utilization"})["T"],
+			},
+		},
+	}
+	p, _ := json.Marshal(products)
+	t, _ := json.Marshal(terms)
+	if termsFirst {
+		return `{"formatVersion":"v1.0","terms":` + string(t) + `,"other":[1,{"a":[2]}],"products":` + string(p) + `}`
+	}
+	return `{"formatVersion":"v1.0","products":` + string(p) + `,"other":[1,{"a":[2]}],"terms":` + string(t) + `}`
+}
+
+func TestParseOffer(t *testing.T) {
+	tests := []struct {
+		name       string
+		termsFirst bool
+		workers    int
+		region     string
+		skus       []string
+	}{
+		{"products first", false, 1, "", []string{"A", "B", "C", "D"}},
+		{"products first on workers", false, 4, "", []string{"A", "B", "C", "D"}},
+		{"terms first", true, 1, "", []string{"A", "B", "C", "D"}},
+		{"terms first on workers", true, 4, "", []string{"A", "B", "C", "D"}},
+		{"one region", false, 4, "us-east-1", []string{"A", "B", "C"}},
+		{"one region terms first", true, 4, "eu-west", []string{"D"}},
+	}
+	demand := map[string]float64{"A": 0.096, "B": 0.384, "C": 0.188, "D": 0.107}
+	for _, tt := range tests {
+		var ec2 Ec2
+		if err := parseOffer(strings.NewReader(testOffer(tt.termsFirst)), &ec2, newOfferFilter(tt.region), tt.workers); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var skus []string
+		for _, i := range ec2.Instance {
+			skus = append(skus, i.Sku)
+			if i.DemandPrice != demand[i.Sku] {
+				t.Errorf("%s: %s on demand at %v, want %v", tt.name, i.Sku, i.DemandPrice, demand[i.Sku])
+			}
+			if i.SpotPrice != 999999.9 {
+				t.Errorf("%s: %s has a spot price of %v before the spot feed", tt.name, i.Sku, i.SpotPrice)
+			}
+			want := []Reservation(nil)
+			if i.Sku == "A" {
+				want = []Reservation{{LeaseContractLength: "1yr", PurchaseOption: "Partial Upfront", OfferingClass: "standard", Upfront: 300, Hourly: 0.02}}
+			}
+			if !reflect.DeepEqual(i.Reservations, want) {
+				t.Errorf("%s: %s reserved %+v, want %+v", tt.name, i.Sku, i.Reservations, want)
+			}
+		}
+		if !reflect.DeepEqual(skus, tt.skus) {
+			t.Errorf("%s: got %v, want %v", tt.name, skus, tt.skus)
+		}
+		for _, i := range ec2.Instance {
+			if _, ok := ec2.Regions[i.RegionCode]; !ok {
+				t.Errorf("%s: region %s of %s missing", tt.name, i.RegionCode, i.Sku)
+			}
+		}
+	}
+}
+
+func TestParseOfferSpecs(t *testing.T) {
+	var ec2 Ec2
+	if err := parseOffer(strings.NewReader(testOffer(false)), &ec2, newOfferFilter(""), 1); err != nil {
+		t.Fatal(err)
+	}
+	b := ec2.Instance[1]
+	if b.Name != "m5.2xlarge" || b.Specs.Cpu != 8 || b.Specs.Mem != 32 || b.Specs.Os != "Linux" || b.Specs.Software != "NA" ||
+		b.Specs.DiskType != "EBS" || b.Specs.NetworkBurstGbps != 10 || b.Specs.NetworkBaselineGbps != 2.5 {
+		t.Errorf("got %+v", b)
+	}
+}
+
+func TestParseOfferMalformed(t *testing.T) {
+	for _, doc := range []string{`[]`, `{"products": [1]}`, `{"terms": {"OnDemand": []}}`, `{"products": {"A": {"sku": 1}}}`, `{"products": {`} {
+		var ec2 Ec2
+		if err := parseOffer(strings.NewReader(doc), &ec2, newOfferFilter(""), 2); err == nil {
+			t.Errorf("%s: no error", doc)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+)
+
+/*
+The pivot view compares the same instance across regions: one row per instance type (and platform and tenancy, should
+the filters let more than one through) and one column per region holding the monthly price of the --sort pricing
+model, the cheapest of which is marked with a *. The trailing columns name the cheapest region for every pricing
+model, as the region cheapest on demand is not always the one cheapest on spot or reserved.
+*/
+
+// regions lists the region codes in the results, sorted.
+func (slice FilteredResults) regions() []string {
+	seen := make(map[string]bool)
+	var codes []string
+	for _, f := range slice {
+		if !seen[f.Instance.RegionCode] {
+			seen[f.Instance.RegionCode] = true
+			codes = append(codes, f.Instance.RegionCode)
+		}
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+type pivotRow struct {
+	first     Ec2Filtered
+	byRegion  map[string]Ec2Filtered
+	sortPrice float64 // the lowest SortPrice of any region
+}
+
+// cheapest finds the region where the row costs least under model.
+func (r pivotRow) cheapest(model string) (string, float64, bool) {
+	var region string
+	var best float64
+	found := false
+	for code, f := range r.byRegion {
+		price, ok := f.monthlyPrice(model)
+		if !ok {
+			continue
+		}
+		if !found || price < best || (price == best && code < region) {
+			region, best, found = code, price, true
+		}
+	}
+	return region, best, found
+}
+
+func doPivot(output FilteredResults, outputSize int, opts FilterOptions) {
+	showLicense := opts.OperatingSystem != "LINUX" || opts.License != "INCLUDED" || opts.Software != "NONE"
+	models := pricingModels
+	if opts.SPType == "" {
+		models = models[:3]
+	}
+	model := sortModel(opts)
+
+	regions := output.regions()
+	rows := make(map[string]*pivotRow)
+	var order []*pivotRow
+	for _, f := range output {
+		key := f.Instance.Name + "|" + f.Instance.Tenancy + "|" + f.Instance.platform()
+		row, ok := rows[key]
+		if !ok {
+			row = &pivotRow{first: f, byRegion: make(map[string]Ec2Filtered), sortPrice: f.SortPrice}
+			rows[key] = row
+			order = append(order, row)
+		}
+		row.byRegion[f.Instance.RegionCode] = f
+		if f.SortPrice < row.sortPrice {
+			row.sortPrice = f.SortPrice
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		if order[a].sortPrice != order[b].sortPrice {
+			return order[a].sortPrice < order[b].sortPrice
+		}
+		return order[a].first.Instance.Name < order[b].first.Instance.Name
+	})
+
+	var data [][]string
+	for n, row := range order {
+		if n >= outputSize {
+			break
+		}
+		name := row.first.Instance.Name
+		if row.first.Instance.Tenancy != "Shared" {
+			name = name + " (" + row.first.Instance.Tenancy + ")"
+		}
+		result := []string{
+			strconv.Itoa(row.first.NumberInstances),
+			name,
+			strconv.Itoa(row.first.Instance.Specs.Cpu),
+			strconv.FormatFloat(row.first.Instance.Specs.Mem, 'f', 1, 64),
+		}
+		if showLicense {
+			result = append(result, row.first.Instance.platform())
+		}
+
+		best, _, _ := row.cheapest(model)
+		for _, code := range regions {
+			f, ok := row.byRegion[code]
+			if !ok {
+				result = append(result, "-")
+				continue
+			}
+			price, ok := f.monthlyPrice(model)
+			if !ok {
+				result = append(result, "N/A")
+				continue
+			}
+			cell := "$" + humanize.Comma(int64(price))
+			if code == best && len(row.byRegion) > 1 {
+				cell = cell + " *"
+			}
+			result = append(result, cell)
+		}
+
+		for _, m := range models {
+			region, price, ok := row.cheapest(m)
+			if !ok {
+				result = append(result, "N/A")
+				continue
+			}
+			result = append(result, region+" ($"+humanize.Comma(int64(price))+")")
+		}
+		data = append(data, result)
+	}
+
+	header := []string{"# Inst", "Type", "VCPU", "Mem"}
+	if showLicense {
+		header = append(header, "Platform")
+	}
+	for _, code := range regions {
+		header = append(header, code+" "+pricingModelNames[model]+"/Mon")
+	}
+	for _, m := range models {
+		header = append(header, "Cheapest "+pricingModelNames[m])
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(header)
+	table.SetBorder(true)
+	table.AppendBulk(data)
+	table.Render()
+}
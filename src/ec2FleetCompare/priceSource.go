@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+/*
+PriceSource abstracts where the raw pricing documents (the EC2 offer file, the spot feed ...) are read from.
+
+Documents are always asked for by their canonical remote location i.e. ec2PricesURL, each backend then decides
+where the bytes actually come from. This keeps the parsers unaware of whether they are talking to AWS, a saved
+offer file on an air-gapped box or a directory of test fixtures.
+*/
+type PriceSource interface {
+	// Open returns a reader for the document published at location, callers must close it.
+	Open(location string) (io.ReadCloser, error)
+	// Remote reports whether location is fetched over the network, only remote documents are cached.
+	Remote(location string) bool
+}
+
+// httpSource fetches documents straight from the AWS endpoints.
+type httpSource struct{}
+
+func (s *httpSource) Open(location string) (io.ReadCloser, error) {
+	resp, err := http.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.New("Fetching " + location + " failed: " + resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (s *httpSource) Remote(location string) bool {
+	return true
+}
+
+// fileSource reads documents from local files. A location is read locally when it is a file:// URL or a plain path,
+// or when files maps it to a local replacement (i.e. --prices-file). Anything else is handed to next.
+type fileSource struct {
+	files map[string]string
+	next  PriceSource
+}
+
+func (s *fileSource) local(location string) string {
+	if file, ok := s.files[location]; ok {
+		location = file
+	}
+	if strings.HasPrefix(location, "file://") {
+		return strings.TrimPrefix(location, "file://")
+	}
+	if !strings.Contains(location, "://") {
+		return location
+	}
+	return ""
+}
+
+func (s *fileSource) Open(location string) (io.ReadCloser, error) {
+	if file := s.local(location); file != "" {
+		return os.Open(file)
+	}
+	if s.next == nil {
+		return nil, errors.New("No local file configured for " + location)
+	}
+	return s.next.Open(location)
+}
+
+func (s *fileSource) Remote(location string) bool {
+	return s.local(location) == "" && s.next != nil && s.next.Remote(location)
+}
+
+// fixtureSource serves every document from a directory. Files are looked up by the path of their remote URL
+// (i.e. <dir>/offers/v1.0/aws/AmazonEC2/current/index.json) falling back to the bare file name (<dir>/index.json).
+type fixtureSource struct {
+	dir string
+}
+
+func (s *fixtureSource) Open(location string) (io.ReadCloser, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(s.dir, filepath.FromSlash(u.Path)))
+	if err == nil {
+		return f, nil
+	}
+	return os.Open(filepath.Join(s.dir, path.Base(u.Path)))
+}
+
+func (s *fixtureSource) Remote(location string) bool {
+	return false
+}
+
+// newPriceSource builds the source selected on the command line, a fixture directory wins over individual files.
+func newPriceSource(fixtureDir string, pricesFile string, spotFile string, advisorFile string, spFile string) PriceSource {
+	if fixtureDir != "" {
+		return &fixtureSource{dir: fixtureDir}
+	}
+	files := map[string]string{}
+	if pricesFile != "" {
+		files[ec2PricesURL] = pricesFile
+	}
+	if spotFile != "" {
+		files[ec2SpotPricesURL] = spotFile
+	}
+	if advisorFile != "" {
+		files[spotAdvisorURL] = advisorFile
+	}
+	if spFile != "" {
+		files[savingsPlanOfferURL] = spFile
+	}
+	return &fileSource{files: files, next: &httpSource{}}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+Every result is priced under each pricing model (--sort options): on demand, spot, the --riType reservation and the
+--sp savings plan. The helpers below read those prices back uniformly, as a monthly total for the fleet or an
+hourly price per instance, and apply the --max-hourly and --max-monthly ceilings.
+*/
+
+// pricingModels are the --sort options in display order.
+var pricingModels = []string{"demand", "spot", "ri", "sp"}
+
+var pricingModelNames = map[string]string{"demand": "Demand", "spot": "Spot", "ri": "RI", "sp": "SP"}
+
+// monthlyPrice is the monthly fleet cost under model, false if it is not sold that way.
+func (f Ec2Filtered) monthlyPrice(model string) (float64, bool) {
+	switch model {
+	case "spot":
+		return f.TotalPriceSpot, f.Instance.SpotPrice != 999999.9 && f.Instance.SpotPrice > 0
+	case "ri":
+		return f.TotalPriceRI, f.TotalPriceRI != 999999999.999999
+	case "sp":
+		return f.TotalPriceSP, f.TotalPriceSP != 999999999.999999
+	}
+	return f.TotalPriceDemand, f.TotalPriceDemand > 0
+}
+
+// hourlyPrice is the effective cost of one instance for an hour under model, RI upfront payments amortized and
+// Dedicated Hosts shared out over the instances placed on them.
+func (f Ec2Filtered) hourlyPrice(model string) (float64, bool) {
+	monthly, ok := f.monthlyPrice(model)
+	if !ok || f.NumberInstances < 1 {
+		return 0, false
+	}
+	return monthly / (24 * 30) / float64(f.NumberInstances), true
+}
+
+// PriceLimits are price ceilings by pricing model.
+type PriceLimits map[string]float64
+
+// parsePriceLimits reads a --max-hourly or --max-monthly option, a comma separated list of model=price i.e.
+// spot=0.2,demand=0.5, where a bare price applies to defaultModel.
+func parsePriceLimits(s string, defaultModel string) (PriceLimits, error) {
+	limits := make(PriceLimits)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		model, price := defaultModel, part
+		if n := strings.Index(part, "="); n >= 0 {
+			model, price = strings.ToLower(strings.TrimSpace(part[:n])), strings.TrimSpace(part[n+1:])
+		}
+		if _, ok := pricingModelNames[model]; !ok {
+			return nil, fmt.Errorf("Unknown pricing model %q in %q, options: %s", model, s, strings.Join(pricingModels, ", "))
+		}
+		value, err := strconv.ParseFloat(strings.TrimPrefix(price, "$"), 64)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("Invalid price %q in %q", price, s)
+		}
+		limits[model] = value
+	}
+	return limits, nil
+}
+
+// within reports whether every ceiling in limits is met by price, a model the result has no price for fails its
+// ceiling.
+func (limits PriceLimits) within(price func(model string) (float64, bool)) bool {
+	for model, limit := range limits {
+		p, ok := price(model)
+		if !ok || p > limit {
+			return false
+		}
+	}
+	return true
+}
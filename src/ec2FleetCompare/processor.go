@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+)
+
+/*
+The offer file names the processor (physicalProcessor, i.e. "Intel Xeon Platinum 8175", "AWS Graviton2 Processor")
+and its features (processorFeatures, i.e. "Intel AVX; Intel AVX2; Intel AVX512; Intel Turbo") but its
+processorArchitecture only ever says "64-bit" or "32 or 64-bit", so the instruction set follows from the processor.
+*/
+
+// processorVendors maps a word in physicalProcessor onto the vendor and architecture it implies, checked in order.
+var processorVendors = []struct {
+	match  string
+	vendor string
+	arch   string
+}{
+	{"graviton", "AWS", "arm64"},
+	{"apple", "Apple", "arm64"},
+	{"amd", "AMD", "x86_64"},
+	{"intel", "Intel", "x86_64"},
+}
+
+// setProcessor fills in the processor specs of i from the offer attributes.
+func setProcessor(i *Instance, attr map[string]string) {
+	i.Specs.Processor = strings.TrimSuffix(strings.TrimSpace(attr["physicalProcessor"]), " Processor")
+	lower := strings.ToLower(i.Specs.Processor)
+	for _, v := range processorVendors {
+		if strings.Contains(lower, v.match) {
+			i.Specs.Vendor = v.vendor
+			i.Specs.Arch = v.arch
+			break
+		}
+	}
+	if i.Specs.Arch == "" && i.Specs.Processor != "" {
+		// "High Frequency Intel Xeon ..." is caught above, anything unknown is assumed to be x86
+		i.Specs.Arch = "x86_64"
+	}
+
+	for _, f := range strings.Split(attr["processorFeatures"], ";") {
+		if f = cpuFeatureName(f); f != "" {
+			i.Specs.CpuFeatures = append(i.Specs.CpuFeatures, f)
+		}
+	}
+}
+
+// cpuFeatureName normalises a processor feature so "Intel AVX-512", "avx512" and "AVX 512" compare equal.
+func cpuFeatureName(f string) string {
+	f = strings.ToUpper(strings.TrimSpace(f))
+	for _, vendor := range []string{"INTEL ", "AMD "} {
+		f = strings.TrimPrefix(f, vendor)
+	}
+	return strings.NewReplacer("-", "", " ", "", "_", "").Replace(f)
+}
+
+// matchesProcessor reports whether s meets the --arch, --vendor and --cpu-feature options, features are a comma
+// separated list which must all be present.
+func (s InstanceSpecs) matchesProcessor(arch string, vendor string, features string) bool {
+	if arch != "ANY" {
+		switch arch {
+		case "ARM", "ARM64", "AARCH64", "GRAVITON":
+			arch = "ARM64"
+		case "X86", "X86_64", "AMD64", "X64":
+			arch = "X86_64"
+		}
+		if !strings.Contains(strings.ToUpper(s.Arch), arch) {
+			return false
+		}
+	}
+	if vendor != "ANY" && strings.ToUpper(s.Vendor) != vendor && !strings.Contains(strings.ToUpper(s.Processor), vendor) {
+		return false
+	}
+	if features != "" && features != "ANY" {
+		for _, want := range strings.Split(features, ",") {
+			want = cpuFeatureName(want)
+			if want == "" {
+				continue
+			}
+			found := false
+			for _, f := range s.CpuFeatures {
+				if f == want {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// processorDesc describes the processor of an instance for display i.e. "AWS Graviton2 (arm64)".
+func (s InstanceSpecs) processorDesc() string {
+	if s.Processor == "" {
+		return ""
+	}
+	return s.Processor + " (" + s.Arch + ")"
+}
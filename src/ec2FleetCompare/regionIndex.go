@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+)
+
+/*
+The Price List bulk API publishes, next to the global offer file, a region_index.json pointing at one offer file per
+region. Those are a fraction of the size of the global file so only the regions actually being queried are fetched,
+each with its own cache entry.
+*/
+
+var ec2PricingEndpoint string = "https://pricing.us-east-1.amazonaws.com"
+var ec2RegionIndexURL string = ec2PricingEndpoint + "/offers/v1.0/aws/AmazonEC2/current/region_index.json"
+
+type regionIndex struct {
+	Regions map[string]regionOffer `json:"regions"`
+}
+
+type regionOffer struct {
+	RegionCode        string `json:"regionCode"`
+	CurrentVersionUrl string `json:"currentVersionUrl"`
+}
+
+// match returns the region codes matching region and geo (the same way doFilter matches them), sorted.
+func (r regionIndex) match(region string, geo string) []string {
+	r_region := regexp.MustCompile(`(?i).*` + region + `.*`)
+
+	var codes []string
+	for code := range r.Regions {
+		if r_region.MatchString(code) && inGeography(code, geo) {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func getRegionIndex(index *regionIndex, src PriceSource, forceDownload bool, skipDownload bool) error {
+	remote := src.Remote(ec2RegionIndexURL)
+	if !remote || forceDownload || readCache(index, "ec2-regions.cache", (24*time.Hour), skipDownload) != nil {
+		if err := getJson(src, ec2RegionIndexURL, index, false); err != nil {
+			return err
+		}
+		if remote {
+			b, _ := json.Marshal(index)
+			if err := writeCache(b, "ec2-regions.cache"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/*
+getDemandPrices fetches demand and reserve prices for every region matching region within the geography geo, one
+offer file (and one cache entry) per region.
+
+A saved offer file given on the command line (--prices-file) replaces the per-region files, as does a fixture
+directory which only holds the global index.json.
+*/
+func getDemandPrices(s *Ec2, src PriceSource, region string, geo string, workers int, forceDownload bool, skipDownload bool) error {
+	if !src.Remote(ec2PricesURL) && src.Remote(ec2RegionIndexURL) {
+		return downloadDemandPrices(src, ec2PricesURL, s, newOfferFilter(region), workers)
+	}
+
+	var index regionIndex
+	if err := getRegionIndex(&index, src, forceDownload, skipDownload); err != nil {
+		if os.IsNotExist(err) && !src.Remote(ec2PricesURL) {
+			return downloadDemandPrices(src, ec2PricesURL, s, newOfferFilter(region), workers)
+		}
+		return err
+	}
+
+	codes := index.match(region, geo)
+	if len(codes) == 0 {
+		return fmt.Errorf("No EC2 offer files found for region %q in geography %q", region, geo)
+	}
+
+	for _, code := range codes {
+		var r Ec2
+		location := ec2PricingEndpoint + index.Regions[code].CurrentVersionUrl
+		cacheFile := "ec2-" + code + ".cache"
+
+		remote := src.Remote(location)
+		if !remote || forceDownload || readCache(&r, cacheFile, (24*time.Hour), skipDownload) != nil {
+			// cache to old download it
+			if remote {
+				fmt.Println("Price cache for " + code + " to old fetching new data ...")
+			}
+			if err := downloadDemandPrices(src, location, &r, offerFilter{region: code}, workers); err != nil {
+				return err
+			}
+
+			// write processed response to cache
+			if remote {
+				b, _ := json.Marshal(r)
+				if err := writeCache(b, cacheFile); err != nil {
+					return err
+				}
+			}
+		}
+		s.Instance = append(s.Instance, r.Instance...)
+		s.addRegions(r.Regions)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+/*
+Region metadata comes from the offer file itself (the regionCode, location and locationType attributes of every
+product) so regions, Local Zones and Wavelength Zones AWS launches show up without a new release. The only thing
+that cannot be read from AWS is the legacy region naming of the spot feed, that lives in an alias table which can be
+extended from the cache directory (region-aliases.json, a JSON object of spot name to region code).
+*/
+
+// Region describes a location instances are sold in.
+type Region struct {
+	Code         string // i.e. us-east-1, us-east-1-bos-1
+	Name         string // i.e. US East (N. Virginia)
+	Partition    string // aws, aws-cn, aws-us-gov ...
+	LocationType string // AWS Region, AWS Local Zone, AWS Wavelength Zone ...
+}
+
+// addRegions merges regions into the regions known to s.
+func (s *Ec2) addRegions(regions map[string]Region) {
+	if s.Regions == nil {
+		s.Regions = make(map[string]Region)
+	}
+	for code, r := range regions {
+		s.Regions[code] = r
+	}
+}
+
+// locationTypes maps the --location options onto the offer file's locationType.
+var locationTypes = map[string]string{
+	"REGION":     "AWS Region",
+	"LOCAL":      "AWS Local Zone",
+	"WAVELENGTH": "AWS Wavelength Zone",
+	"OUTPOSTS":   "AWS Outposts",
+}
+
+// locationNames lists the --location options for help and error output.
+func locationNames() []string {
+	names := []string{"any"}
+	for name := range locationTypes {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// inGeography reports whether the region code is within geo, a comma separated list of region code prefixes i.e.
+// "eu" or "us,ca" (GovCloud is part of us), or "any".
+func inGeography(code string, geo string) bool {
+	if geo == "" || strings.EqualFold(geo, "any") {
+		return true
+	}
+	for _, g := range strings.Split(geo, ",") {
+		g = strings.ToLower(strings.TrimSpace(g))
+		if g != "" && strings.HasPrefix(code, g+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// partitionPrefixes maps region code prefixes onto their partition, anything else is in the aws partition.
+var partitionPrefixes = []struct {
+	prefix    string
+	partition string
+}{
+	{"us-gov-", "aws-us-gov"},
+	{"cn-", "aws-cn"},
+	{"us-isob-", "aws-iso-b"},
+	{"us-iso-", "aws-iso"},
+	{"eu-isoe-", "aws-iso-e"},
+	{"us-isof-", "aws-iso-f"},
+}
+
+func partitionOf(code string) string {
+	for _, p := range partitionPrefixes {
+		if strings.HasPrefix(code, p.prefix) {
+			return p.partition
+		}
+	}
+	return "aws"
+}
+
+func newRegion(code string, name string, locationType string) Region {
+	if locationType == "" {
+		locationType = "AWS Region"
+	}
+	return Region{Code: code, Name: name, Partition: partitionOf(code), LocationType: locationType}
+}
+
+// spotRegionAliases maps the legacy region names still used by the spot feed onto region codes, newer regions are
+// published under their code and need no entry.
+var spotRegionAliases = map[string]string{
+	"us-east":    "us-east-1",
+	"us-west":    "us-west-1",
+	"eu-ireland": "eu-west-1",
+	"apac-sin":   "ap-southeast-1",
+	"apac-syd":   "ap-southeast-2",
+	"apac-tokyo": "ap-northeast-1",
+}
+
+// loadRegionAliases merges region-aliases.json from the cache directory into spotRegionAliases, a missing file is fine.
+func loadRegionAliases() error {
+	home, err := homedir.Dir()
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadFile(home + "/" + cacheDir + "/region-aliases.json")
+	if err != nil {
+		return nil
+	}
+	var aliases map[string]string
+	if err := json.Unmarshal(b, &aliases); err != nil {
+		return err
+	}
+	for name, code := range aliases {
+		spotRegionAliases[name] = code
+	}
+	return nil
+}
+
+// spotRegionCode resolves a spot feed region name to a region code.
+func spotRegionCode(name string) string {
+	if code, ok := spotRegionAliases[name]; ok {
+		return code
+	}
+	return name
+}
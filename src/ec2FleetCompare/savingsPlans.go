@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Savings Plans are published as their own offer, one file per region listed in a region index just like the EC2 offer:
+
+	{ "regionCode": ..., "products": [ { "sku": ..., "productFamily": "ComputeSavingsPlans", "attributes": { "purchaseTerm": "1yr", "purchaseOption": "No Upfront", ... } } ],
+	  "terms": { "savingsPlan": [ { "sku": ..., "rates": [ { "discountedUsageType": "USE1-BoxUsage:c5.large", "discountedOperation": "RunInstances", "discountedRate": { "price": "0.06" } } ] } ] } }
+
+Each rate is joined back onto an Instance by its usage type, which carries the region, tenancy and instance type, and
+its operation, which carries the operating system.
+*/
+
+var savingsPlanRegionIndexURL string = ec2PricingEndpoint + "/savingsPlan/v1.0/aws/AWSComputeSavingsPlan/current/region_index.json"
+var savingsPlanOfferURL string = ec2PricingEndpoint + "/savingsPlan/v1.0/aws/AWSComputeSavingsPlan/current/index.json"
+
+// SavingsPlanType is a plan family paid for over a term with a payment option.
+type SavingsPlanType struct {
+	Family         string // "ComputeSavingsPlans", "EC2InstanceSavingsPlans"
+	PurchaseTerm   string // "1yr", "3yr"
+	PurchaseOption string // "No Upfront", "Partial Upfront", "All Upfront"
+}
+
+// spTypes maps the --sp options onto the plan they select, ec2- picks the EC2 Instance Savings Plan.
+var spTypes = map[string]SavingsPlanType{
+	"zero1":        {"ComputeSavingsPlans", "1yr", "No Upfront"},
+	"partial1":     {"ComputeSavingsPlans", "1yr", "Partial Upfront"},
+	"full1":        {"ComputeSavingsPlans", "1yr", "All Upfront"},
+	"zero3":        {"ComputeSavingsPlans", "3yr", "No Upfront"},
+	"partial3":     {"ComputeSavingsPlans", "3yr", "Partial Upfront"},
+	"full3":        {"ComputeSavingsPlans", "3yr", "All Upfront"},
+	"ec2-zero1":    {"EC2InstanceSavingsPlans", "1yr", "No Upfront"},
+	"ec2-partial1": {"EC2InstanceSavingsPlans", "1yr", "Partial Upfront"},
+	"ec2-full1":    {"EC2InstanceSavingsPlans", "1yr", "All Upfront"},
+	"ec2-zero3":    {"EC2InstanceSavingsPlans", "3yr", "No Upfront"},
+	"ec2-partial3": {"EC2InstanceSavingsPlans", "3yr", "Partial Upfront"},
+	"ec2-full3":    {"EC2InstanceSavingsPlans", "3yr", "All Upfront"},
+}
+
+// SavingsPlanRates holds the effective hourly rates of one plan type, keyed by savingsPlanKey.
+type SavingsPlanRates struct {
+	Rates map[string]float64
+}
+
+func savingsPlanKey(usageType string, operation string) string {
+	return usageType + "|" + operation
+}
+
+type savingsPlanRegionIndex struct {
+	Regions []struct {
+		RegionCode string `json:"regionCode"`
+		VersionUrl string `json:"versionUrl"`
+	} `json:"regions"`
+}
+
+type savingsPlanProduct struct {
+	Sku           string            `json:"sku"`
+	ProductFamily string            `json:"productFamily"`
+	Attributes    map[string]string `json:"attributes"`
+}
+
+type savingsPlanTerm struct {
+	Sku   string `json:"sku"`
+	Rates []struct {
+		DiscountedUsageType   string `json:"discountedUsageType"`
+		DiscountedOperation   string `json:"discountedOperation"`
+		DiscountedServiceCode string `json:"discountedServiceCode"`
+		Unit                  string `json:"unit"`
+		DiscountedRate        struct {
+			Price string `json:"price"`
+		} `json:"discountedRate"`
+	} `json:"rates"`
+}
+
+func downloadSavingsPlans(src PriceSource, location string, plan SavingsPlanType, rates *SavingsPlanRates) error {
+	body, err := src.Open(location)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	return parseSavingsPlans(bufio.NewReaderSize(body, 1<<20), plan, rates)
+}
+
+// parseSavingsPlans streams a Savings Plans offer file keeping only the EC2 rates of plan.
+func parseSavingsPlans(r *bufio.Reader, plan SavingsPlanType, rates *SavingsPlanRates) error {
+	if rates.Rates == nil {
+		rates.Rates = make(map[string]float64)
+	}
+	wanted := make(map[string]bool)
+
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		key, err := nextKey(dec)
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "products":
+			err = eachArrayValue(dec, func() error {
+				var p savingsPlanProduct
+				if err := dec.Decode(&p); err != nil {
+					return err
+				}
+				if p.ProductFamily == plan.Family &&
+					p.Attributes["purchaseTerm"] == plan.PurchaseTerm &&
+					p.Attributes["purchaseOption"] == plan.PurchaseOption {
+					wanted[p.Sku] = true
+				}
+				return nil
+			})
+		case "terms":
+			err = eachObjectValue(dec, func(termType string) error {
+				if termType != "savingsPlan" {
+					return skipValue(dec)
+				}
+				return eachArrayValue(dec, func() error {
+					var t savingsPlanTerm
+					if err := dec.Decode(&t); err != nil {
+						return err
+					}
+					if !wanted[t.Sku] {
+						return nil
+					}
+					for _, rate := range t.Rates {
+						if rate.DiscountedServiceCode != "AmazonEC2" || rate.Unit != "Hrs" {
+							continue
+						}
+						price, err := strconv.ParseFloat(rate.DiscountedRate.Price, 64)
+						if err != nil {
+							continue
+						}
+						rates.Rates[savingsPlanKey(rate.DiscountedUsageType, rate.DiscountedOperation)] = price
+					}
+					return nil
+				})
+			})
+		default:
+			err = skipValue(dec)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+/*
+getSavingsPlans fetches the rates of the savings plan spType for every region the demand prices were loaded for and
+sets SavingsPlanPrice on each matching instance. Like getDemandPrices a saved offer file (--sp-file) replaces the
+per-region files and each region has its own cache entry.
+*/
+func getSavingsPlans(s *Ec2, src PriceSource, spType string, forceDownload bool, skipDownload bool) error {
+	plan, ok := spTypes[spType]
+	if !ok {
+		return fmt.Errorf("Unknown savings plan type %q, options: %s", spType, strings.Join(spTypeNames(), ", "))
+	}
+
+	single := func() error {
+		var rates SavingsPlanRates
+		if err := downloadSavingsPlans(src, savingsPlanOfferURL, plan, &rates); err != nil {
+			return err
+		}
+		combineSavingsPlans(s, &rates)
+		return nil
+	}
+	if !src.Remote(savingsPlanOfferURL) && src.Remote(savingsPlanRegionIndexURL) {
+		return single()
+	}
+
+	var index savingsPlanRegionIndex
+	remote := src.Remote(savingsPlanRegionIndexURL)
+	if !remote || forceDownload || readCache(&index, "sp-regions.cache", (24*time.Hour), skipDownload) != nil {
+		if err := getJson(src, savingsPlanRegionIndexURL, &index, false); err != nil {
+			if os.IsNotExist(err) && !src.Remote(savingsPlanOfferURL) {
+				return single()
+			}
+			return err
+		}
+		if remote {
+			b, _ := json.Marshal(index)
+			if err := writeCache(b, "sp-regions.cache"); err != nil {
+				return err
+			}
+		}
+	}
+
+	regions := make(map[string]bool)
+	for _, i := range s.Instance {
+		regions[i.RegionCode] = true
+	}
+
+	for _, region := range index.Regions {
+		if !regions[region.RegionCode] {
+			continue
+		}
+		var r SavingsPlanRates
+		location := ec2PricingEndpoint + region.VersionUrl
+		cacheFile := "sp-" + spType + "-" + region.RegionCode + ".cache"
+
+		remote := src.Remote(location)
+		if !remote || forceDownload || readCache(&r, cacheFile, (24*time.Hour), skipDownload) != nil {
+			if remote {
+				fmt.Println("Savings plan cache for " + region.RegionCode + " to old fetching new data ...")
+			}
+			if err := downloadSavingsPlans(src, location, plan, &r); err != nil {
+				return err
+			}
+			if remote {
+				b, _ := json.Marshal(r)
+				if err := writeCache(b, cacheFile); err != nil {
+					return err
+				}
+			}
+		}
+		combineSavingsPlans(s, &r)
+	}
+	return nil
+}
+
+// combineSavingsPlans sets SavingsPlanPrice on every instance the plan has a rate for.
+func combineSavingsPlans(s *Ec2, rates *SavingsPlanRates) {
+	for i := range s.Instance {
+		if price, ok := rates.Rates[savingsPlanKey(s.Instance[i].UsageType, s.Instance[i].Operation)]; ok {
+			s.Instance[i].SavingsPlanPrice = price
+		}
+		// the instances on a Dedicated Host are covered through the host's own usage
+		if h := s.Instance[i].Host; h != nil {
+			if price, ok := rates.Rates[savingsPlanKey(h.UsageType, h.Operation)]; ok {
+				h.SavingsPlanPrice = price
+			}
+		}
+	}
+}
+
+// spTypeNames lists the --sp options for help and error output.
+func spTypeNames() []string {
+	var names []string
+	for name := range spTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// eachArrayValue calls fn once per element of the array dec is positioned at, fn must consume the element.
+func eachArrayValue(dec *json.Decoder, fn func() error) error {
+	if err := expectDelim(dec, '['); err != nil {
+		return err
+	}
+	for dec.More() {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+// eachObjectValue calls fn once per key of the object dec is positioned at, fn must consume the value.
+func eachObjectValue(dec *json.Decoder, fn func(key string) error) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		key, err := nextKey(dec)
+		if err != nil {
+			return err
+		}
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+)
+
+/*
+Fleet sizing finds how many copies of an instance it takes to reach every fleet wide target at once: vCPUs, GiB of
+memory, GB of instance store, Gbps of aggregate (baseline) network and accelerators. Each target on its own needs
+ceil(target / per instance) instances, the fleet needs the most of those and the resource behind it is the binding
+one, the one to look at to make the fleet smaller. A burstable instance counts the vCPUs it can sustain, see
+burstable.go.
+*/
+
+// fleetResource is a resource fleet sizing can require a total of.
+type fleetResource struct {
+	Name string
+	need func(opts FilterOptions) float64
+	has  func(i Instance, opts FilterOptions) float64
+}
+
+var fleetResources = []fleetResource{
+	{"VCPU", func(o FilterOptions) float64 { return float64(o.MinFleetCPU) }, func(i Instance, o FilterOptions) float64 { return i.sustainedVcpus(o) }},
+	{"Mem", func(o FilterOptions) float64 { return float64(o.MinFleetMem) }, func(i Instance, o FilterOptions) float64 { return i.Specs.Mem }},
+	{"Disk", func(o FilterOptions) float64 { return float64(o.MinFleetDisk) }, func(i Instance, o FilterOptions) float64 { return float64(i.Specs.DiskSize) }},
+	{"Network", func(o FilterOptions) float64 { return o.MinFleetNetwork }, func(i Instance, o FilterOptions) float64 { return i.Specs.NetworkBaselineGbps }},
+	{"GPU", func(o FilterOptions) float64 { return float64(o.MinFleetGPU) }, func(i Instance, o FilterOptions) float64 { return float64(i.Specs.Gpu) }},
+}
+
+// fleetSize is the number of instances of i needed to meet every fleet target in opts and the name of the resource
+// needing the most. ok is false if i lacks a resource a target is set for, no number of them would do.
+func fleetSize(i Instance, opts FilterOptions) (numServers int, binding string, ok bool) {
+	numServers = 1
+	for _, r := range fleetResources {
+		need := r.need(opts)
+		if need <= 0 {
+			continue
+		}
+		has := r.has(i, opts)
+		if has <= 0 {
+			return 0, r.Name, false
+		}
+		n := int(math.Ceil(need / has))
+		if binding == "" || n > numServers {
+			binding = r.Name
+		}
+		if n > numServers {
+			numServers = n
+		}
+	}
+	return numServers, binding, true
+}
+
+// withoutFleetTargets is opts with every fleet wide target cleared, so each instance is looked at on its own.
+func withoutFleetTargets(opts FilterOptions) FilterOptions {
+	opts.InstanceCount = 1
+	opts.MinInstanceCount = 1
+	opts.MinFleetCPU = 0
+	opts.MinFleetMem = 0
+	opts.MinFleetDisk = 0
+	opts.MinFleetNetwork = 0
+	opts.MinFleetGPU = 0
+	opts.MaxInstanceCount = 0
+	opts.MaxMonthly = nil
+	return opts
+}
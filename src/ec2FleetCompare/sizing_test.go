@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestFleetSize(t *testing.T) {
+	i := Instance{Name: "g4dn.2xlarge", Specs: InstanceSpecs{Cpu: 8, Mem: 32, DiskSize: 225, NetworkBaselineGbps: 2.5, Gpu: 1}}
+	noGpu := Instance{Name: "m5.2xlarge", Specs: InstanceSpecs{Cpu: 8, Mem: 32, NetworkBaselineGbps: 2.5}}
+	tests := []struct {
+		name    string
+		i       Instance
+		set     func(o *FilterOptions)
+		num     int
+		binding string
+		ok      bool
+	}{
+		{"no targets", i, func(o *FilterOptions) {}, 1, "", true},
+		{"under one instance", i, func(o *FilterOptions) { o.MinFleetCPU = 2 }, 1, "VCPU", true},
+		{"vcpus", i, func(o *FilterOptions) { o.MinFleetCPU = 64 }, 8, "VCPU", true},
+		{"memory", i, func(o *FilterOptions) { o.MinFleetMem = 100 }, 4, "Mem", true},
+		{"memory over vcpus", i, func(o *FilterOptions) { o.MinFleetCPU = 16; o.MinFleetMem = 100 }, 4, "Mem", true},
+		{"vcpus over memory", i, func(o *FilterOptions) { o.MinFleetCPU = 40; o.MinFleetMem = 100 }, 5, "VCPU", true},
+		{"a tie stays with the first", i, func(o *FilterOptions) { o.MinFleetCPU = 32; o.MinFleetMem = 128 }, 4, "VCPU", true},
+		{"disk", i, func(o *FilterOptions) { o.MinFleetCPU = 8; o.MinFleetDisk = 1000 }, 5, "Disk", true},
+		{"baseline network", i, func(o *FilterOptions) { o.MinFleetMem = 64; o.MinFleetNetwork = 10 }, 4, "Network", true},
+		{"gpus", i, func(o *FilterOptions) { o.MinFleetCPU = 16; o.MinFleetGPU = 3 }, 3, "GPU", true},
+		{"no gpus", noGpu, func(o *FilterOptions) { o.MinFleetCPU = 16; o.MinFleetGPU = 1 }, 0, "GPU", false},
+		{"no instance store", noGpu, func(o *FilterOptions) { o.MinFleetDisk = 100 }, 0, "Disk", false},
+	}
+	for _, tt := range tests {
+		opts := testFilterOptions()
+		opts.MinFleetCPU, opts.MinFleetMem = 0, 0
+		tt.set(&opts)
+		num, binding, ok := fleetSize(tt.i, opts)
+		if num != tt.num || binding != tt.binding || ok != tt.ok {
+			t.Errorf("%s: got %d %q %v, want %d %q %v", tt.name, num, binding, ok, tt.num, tt.binding, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+The Spot Instance Advisor publishes, per region, OS and instance type, how often spot capacity has been reclaimed
+over the last month as a band and the usual saving over on demand:
+
+	{ "ranges": [ { "index": 0, "label": "<5%", "max": 5 }, { "index": 1, "label": "5-10%", "max": 11 }, ... ],
+	  "spot_advisor": { "us-east-1": { "Linux": { "m5.large": { "s": 70, "r": 0 }, ... }, "Windows": { ... } } } }
+
+r indexes ranges, s is the saving in %. The advisor only tells Linux and Windows apart, every other OS runs on the
+Linux pools. A band is compared against --max-interruption by the top of its label, >20% counting as 100.
+*/
+
+var spotAdvisorURL string = "https://spot-bid-advisor.s3.amazonaws.com/spot-advisor-data.json"
+
+// SpotInterruption is the advisor's figure for one spot pool.
+type SpotInterruption struct {
+	Band    string  // label i.e. "<5%", "5-10%"
+	Max     float64 // top of the band in %
+	Savings int     // usual saving over on demand in %
+}
+
+// SpotAdvisor holds the interruption bands by spotAdvisorKey.
+type SpotAdvisor struct {
+	Pools map[string]SpotInterruption
+}
+
+func spotAdvisorKey(region string, os string, name string) string {
+	if !strings.EqualFold(os, "Windows") {
+		os = "Linux"
+	}
+	return region + "|" + os + "|" + name
+}
+
+type spotAdvisorData struct {
+	Ranges []struct {
+		Index int    `json:"index"`
+		Label string `json:"label"`
+	} `json:"ranges"`
+	SpotAdvisor map[string]map[string]map[string]struct {
+		Savings int `json:"s"`
+		Range   int `json:"r"`
+	} `json:"spot_advisor"`
+}
+
+var r_band = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*%?\s*$`)
+
+// bandMax is the top of an interruption band label in %.
+func bandMax(label string) float64 {
+	label = strings.TrimSpace(label)
+	if strings.HasPrefix(label, ">") {
+		return 100
+	}
+	if m := r_band.FindStringSubmatch(label); m != nil {
+		max, _ := strconv.ParseFloat(m[1], 64)
+		return max
+	}
+	return 100
+}
+
+func downloadSpotAdvisor(src PriceSource, advisor *SpotAdvisor) error {
+	var data spotAdvisorData
+	if err := getJson(src, spotAdvisorURL, &data, false); err != nil {
+		return err
+	}
+	bands := make(map[int]string)
+	for _, r := range data.Ranges {
+		bands[r.Index] = r.Label
+	}
+
+	advisor.Pools = make(map[string]SpotInterruption)
+	for region, byOs := range data.SpotAdvisor {
+		for os, byType := range byOs {
+			for name, pool := range byType {
+				band, ok := bands[pool.Range]
+				if !ok {
+					continue
+				}
+				advisor.Pools[spotAdvisorKey(region, os, name)] = SpotInterruption{Band: band, Max: bandMax(band), Savings: pool.Savings}
+			}
+		}
+	}
+	return nil
+}
+
+// getSpotAdvisor adds the interruption band to every instance sold as spot. The advisor is only downloaded when
+// required, for --max-interruption, otherwise the bands come from a local advisor file or the cache if there is one
+// and advisor data that can't be read leaves them unknown with a warning. A local advisor file that isn't there (a
+// fixture directory without one) leaves the bands unknown either way.
+func getSpotAdvisor(s *Ec2, src PriceSource, required bool, forceDownload bool, skipDownload bool) error {
+	var advisor SpotAdvisor
+	remote := src.Remote(spotAdvisorURL)
+	if remote && !required {
+		// nothing is downloaded for the column alone, a cached copy of any age will do
+		if readCache(&advisor, "spot-advisor.cache", (24*time.Hour), true) == nil {
+			combineSpotAdvisor(s, &advisor)
+		}
+		return nil
+	}
+	if !remote || forceDownload || readCache(&advisor, "spot-advisor.cache", (24*time.Hour), skipDownload) != nil {
+		if err := downloadSpotAdvisor(src, &advisor); err != nil {
+			if os.IsNotExist(err) && !remote {
+				return nil
+			}
+			if !required {
+				printWarning("Spot interruption bands unknown, the Spot Instance Advisor data could not be read: " + err.Error())
+				return nil
+			}
+			return err
+		}
+		if remote {
+			b, _ := json.Marshal(advisor)
+			if err := writeCache(b, "spot-advisor.cache"); err != nil {
+				return err
+			}
+		}
+	}
+	combineSpotAdvisor(s, &advisor)
+	return nil
+}
+
+func combineSpotAdvisor(s *Ec2, advisor *SpotAdvisor) {
+	for i := range s.Instance {
+		if s.Instance[i].SpotPrice <= 0 || s.Instance[i].SpotPrice == 999999.9 {
+			continue
+		}
+		if pool, ok := advisor.Pools[spotAdvisorKey(s.Instance[i].RegionCode, s.Instance[i].Specs.Os, s.Instance[i].Name)]; ok {
+			s.Instance[i].Interruption = &pool
+		}
+	}
+}
+
+// hasInterruption reports whether the advisor gave an interruption band for any instance of s.
+func (s Ec2) hasInterruption() bool {
+	for _, i := range s.Instance {
+		if i.Interruption != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// interruptionDesc is the interruption band of i for display, N/A if the advisor has no figure for it.
+func (i Instance) interruptionDesc() string {
+	if i.Interruption == nil {
+		return "N/A"
+	}
+	return i.Interruption.Band
+}
+
+// withinInterruption reports whether i's spot pool is reclaimed no more often than max %, 0 for no limit. A pool
+// the advisor knows nothing of fails any limit.
+func (i Instance) withinInterruption(max float64) bool {
+	if max <= 0 {
+		return true
+	}
+	return i.Interruption != nil && i.Interruption.Max <= max
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestBandMax(t *testing.T) {
+	tests := map[string]float64{
+		"<5%":     5,
+		"5-10%":   10,
+		"10-15%":  15,
+		"15-20%":  20,
+		">20%":    100,
+		" 7.5 %":  7.5,
+		"":        100,
+		"unknown": 100,
+	}
+	for in, want := range tests {
+		if got := bandMax(in); got != want {
+			t.Errorf("%q: got %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestWithinInterruption(t *testing.T) {
+	band := func(max float64) *SpotInterruption { return &SpotInterruption{Max: max} }
+	tests := []struct {
+		interruption *SpotInterruption
+		max          float64
+		want         bool
+	}{
+		{band(5), 10, true},
+		{band(10), 10, true},
+		{band(15), 10, false},
+		{nil, 10, false},
+		{nil, 0, true},
+		{band(100), 0, true},
+	}
+	for _, tt := range tests {
+		i := Instance{Interruption: tt.interruption}
+		if got := i.withinInterruption(tt.max); got != tt.want {
+			t.Errorf("%+v under %v: got %v", tt.interruption, tt.max, got)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+spot.js only has the spot price of the moment. --spot-history reads the output of EC2 DescribeSpotPriceHistory, from
+a local file or any URL serving it, one price per availability zone each time it changed:
+
+	{ "SpotPriceHistory": [ { "AvailabilityZone": "us-east-1a", "InstanceType": "m5.large",
+	  "ProductDescription": "Linux/UNIX", "SpotPrice": "0.035", "Timestamp": "2024-01-01T00:00:00.000Z" }, ... ] }
+
+A price holds until the next one of its zone, so the statistics are weighted by how long each price held over the
+--history-window ending at the newest price in the history, not by how many times it was published. The zones of a
+pool are pooled together, a result's figures are those of a spot instance landing in any of them.
+*/
+
+// SpotPricePoint is a spot price of one availability zone from Time on.
+type SpotPricePoint struct {
+	Zone  string
+	Price float64
+	Time  time.Time
+}
+
+// SpotHistory holds the price changes by spotHistoryKey.
+type SpotHistory struct {
+	Series map[string][]SpotPricePoint
+	Newest time.Time
+}
+
+// SpotStats are the statistics of a spot price per instance hour over the window.
+type SpotStats struct {
+	Min    float64
+	Max    float64
+	Mean   float64
+	P95    float64
+	StdDev float64
+}
+
+// historySorts maps the --sort options on spot history onto the monthly fleet figure they sort by, the cost at
+// that price or, for spot-stddev, how far it swings.
+var historySorts = map[string]func(f Ec2Filtered) float64{
+	"spot-min":    historyMonthly(func(s SpotStats) float64 { return s.Min }, true),
+	"spot-mean":   historyMonthly(func(s SpotStats) float64 { return s.Mean }, true),
+	"spot-p95":    historyMonthly(func(s SpotStats) float64 { return s.P95 }, true),
+	"spot-max":    historyMonthly(func(s SpotStats) float64 { return s.Max }, true),
+	"spot-stddev": historyMonthly(func(s SpotStats) float64 { return s.StdDev }, false),
+}
+
+// spotProducts maps the ProductDescription of a spot price onto the operating system of the offer file.
+var spotProducts = map[string]string{
+	"Linux/UNIX":               "Linux",
+	"SUSE Linux":               "SUSE",
+	"Red Hat Enterprise Linux": "RHEL",
+	"Windows":                  "Windows",
+}
+
+func spotHistoryKey(region string, os string, name string) string {
+	return region + "|" + os + "|" + name
+}
+
+var r_zone = regexp.MustCompile(`^(.*\d)[a-z]+$`)
+
+// zoneRegion is the region (or Local Zone) code of an availability zone i.e. us-east-1 for us-east-1a.
+func zoneRegion(zone string) string {
+	if m := r_zone.FindStringSubmatch(zone); m != nil {
+		return m[1]
+	}
+	return zone
+}
+
+type spotHistoryData struct {
+	SpotPriceHistory []struct {
+		AvailabilityZone   string `json:"AvailabilityZone"`
+		InstanceType       string `json:"InstanceType"`
+		ProductDescription string `json:"ProductDescription"`
+		SpotPrice          string `json:"SpotPrice"`
+		Timestamp          string `json:"Timestamp"`
+	} `json:"SpotPriceHistory"`
+}
+
+func downloadSpotHistory(src PriceSource, location string, history *SpotHistory) error {
+	var data spotHistoryData
+	if err := getJson(src, location, &data, false); err != nil {
+		return err
+	}
+
+	history.Series = make(map[string][]SpotPricePoint)
+	for _, p := range data.SpotPriceHistory {
+		os, ok := spotProducts[strings.TrimSuffix(p.ProductDescription, " (Amazon VPC)")]
+		if !ok {
+			continue
+		}
+		price, err := strconv.ParseFloat(p.SpotPrice, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid spot price %q in %s", p.SpotPrice, location)
+		}
+		t, err := time.Parse(time.RFC3339, p.Timestamp)
+		if err != nil {
+			return fmt.Errorf("Invalid timestamp %q in %s", p.Timestamp, location)
+		}
+		key := spotHistoryKey(zoneRegion(p.AvailabilityZone), os, p.InstanceType)
+		history.Series[key] = append(history.Series[key], SpotPricePoint{Zone: p.AvailabilityZone, Price: price, Time: t})
+		if t.After(history.Newest) {
+			history.Newest = t
+		}
+	}
+	return nil
+}
+
+// getSpotHistory reads the spot price history at location and sets the statistics over window of every instance
+// sold as spot. Remote histories are cached like the spot feed.
+func getSpotHistory(s *Ec2, src PriceSource, location string, window time.Duration, forceDownload bool, skipDownload bool) error {
+	var history SpotHistory
+	h := fnv.New32a()
+	h.Write([]byte(location))
+	cacheFile := "spot-history-" + strconv.FormatUint(uint64(h.Sum32()), 16) + ".cache"
+
+	remote := src.Remote(location)
+	if !remote || forceDownload || readCache(&history, cacheFile, (30*time.Minute), skipDownload) != nil {
+		if err := downloadSpotHistory(src, location, &history); err != nil {
+			return err
+		}
+		if remote {
+			b, _ := json.Marshal(history)
+			if err := writeCache(b, cacheFile); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := range s.Instance {
+		// joined on the history itself, an instance spot.js has no price for still gets its zones
+		if !s.Instance[i].spotEligible() {
+			continue
+		}
+		points := history.Series[spotHistoryKey(s.Instance[i].RegionCode, s.Instance[i].Specs.Os, s.Instance[i].Name)]
+		if stats, ok := spotStats(points, history.Newest.Add(-window), history.Newest); ok {
+			s.Instance[i].SpotHistory = &stats
+			s.Instance[i].SpotZones = latestZonePrices(points)
+		}
+	}
+	return nil
+}
+
+// spotSegment is a price and how long it held.
+type spotSegment struct {
+	price  float64
+	weight float64
+}
+
+// spotSegments splits the prices of each zone in points into how long each held between start and end. The price
+// in force at start is the last one published before it.
+func spotSegments(points []SpotPricePoint, start time.Time, end time.Time) []spotSegment {
+	byZone := make(map[string][]SpotPricePoint)
+	for _, p := range points {
+		byZone[p.Zone] = append(byZone[p.Zone], p)
+	}
+
+	var segments []spotSegment
+	for _, zone := range byZone {
+		sort.Slice(zone, func(a, b int) bool { return zone[a].Time.Before(zone[b].Time) })
+		for n, p := range zone {
+			from, to := p.Time, end
+			if n+1 < len(zone) {
+				to = zone[n+1].Time
+			}
+			if from.Before(start) {
+				from = start
+			}
+			if to.After(end) {
+				to = end
+			}
+			// prices replaced before the window opened
+			if to.Before(from) || (to.Equal(from) && p.Time.Before(start)) {
+				continue
+			}
+			segments = append(segments, spotSegment{p.Price, to.Sub(from).Hours()})
+		}
+	}
+	return segments
+}
+
+// spotStats computes the time weighted statistics of points over the window from start to end, false if no price
+// falls in it. Should every price in the window be an instant (a history of one point per zone), each counts once.
+func spotStats(points []SpotPricePoint, start time.Time, end time.Time) (SpotStats, bool) {
+	segments := spotSegments(points, start, end)
+	if len(segments) == 0 {
+		return SpotStats{}, false
+	}
+
+	var total float64
+	for _, s := range segments {
+		total += s.weight
+	}
+	if total == 0 {
+		for n := range segments {
+			segments[n].weight = 1
+		}
+		total = float64(len(segments))
+	}
+
+	stats := SpotStats{Min: math.Inf(1), Max: math.Inf(-1)}
+	for _, s := range segments {
+		stats.Min = math.Min(stats.Min, s.price)
+		stats.Max = math.Max(stats.Max, s.price)
+		stats.Mean += s.price * s.weight / total
+	}
+	var variance float64
+	for _, s := range segments {
+		variance += (s.price - stats.Mean) * (s.price - stats.Mean) * s.weight / total
+	}
+	stats.StdDev = math.Sqrt(variance)
+
+	sort.Slice(segments, func(a, b int) bool { return segments[a].price < segments[b].price })
+	var cumulative float64
+	for _, s := range segments {
+		cumulative += s.weight
+		stats.P95 = s.price
+		if cumulative >= 0.95*total {
+			break
+		}
+	}
+	return stats, true
+}
+
+// parseWindow reads the --history-window option, a Go duration i.e. 72h or a number of days i.e. 7d.
+func parseWindow(s string) (time.Duration, error) {
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		if n, err := strconv.ParseFloat(days, 64); err == nil && n > 0 {
+			return time.Duration(n * 24 * float64(time.Hour)), nil
+		}
+	} else if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("Invalid history window %q, i.e. 7d or 36h", s)
+}
+
+// historyHourly reads stat of the spot history of a result, NaN if there is none.
+func historyHourly(stat func(s SpotStats) float64) func(f Ec2Filtered) float64 {
+	return func(f Ec2Filtered) float64 {
+		if f.Instance.SpotHistory == nil {
+			return math.NaN()
+		}
+		return stat(*f.Instance.SpotHistory)
+	}
+}
+
+// historyMonthly reads stat of the spot history of a result as a monthly figure for the fleet, with any unlimited
+// mode surplus credit charges if it is a cost. NaN if there is no history.
+func historyMonthly(stat func(s SpotStats) float64, cost bool) func(f Ec2Filtered) float64 {
+	return func(f Ec2Filtered) float64 {
+		if f.Instance.SpotHistory == nil {
+			return math.NaN()
+		}
+		monthly := stat(*f.Instance.SpotHistory) * float64(f.NumberInstances) * 24 * 30
+		if cost {
+			monthly += f.SurplusMonthly
+		}
+		return monthly
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var historyStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// at is historyStart plus n hours.
+func at(n int) time.Time {
+	return historyStart.Add(time.Duration(n) * time.Hour)
+}
+
+func TestSpotSegments(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []SpotPricePoint
+		want   []spotSegment
+	}{
+		{"price holds until the next", []SpotPricePoint{{"a", 1, at(0)}, {"a", 2, at(4)}}, []spotSegment{{1, 4}, {2, 6}}},
+		{"price in force at the start", []SpotPricePoint{{"a", 5, at(-3)}, {"a", 1, at(2)}}, []spotSegment{{1, 8}, {5, 2}}},
+		{"replaced before the window", []SpotPricePoint{{"a", 9, at(-5)}, {"a", 1, at(-1)}}, []spotSegment{{1, 10}}},
+		{"replaced right at the start", []SpotPricePoint{{"a", 9, at(-5)}, {"a", 1, at(0)}}, []spotSegment{{1, 10}}},
+		{"after the window", []SpotPricePoint{{"a", 1, at(0)}, {"a", 7, at(12)}}, []spotSegment{{1, 10}}},
+		{"zones held apart", []SpotPricePoint{{"a", 1, at(0)}, {"b", 2, at(5)}, {"a", 3, at(8)}}, []spotSegment{{1, 8}, {2, 5}, {3, 2}}},
+		{"out of order", []SpotPricePoint{{"a", 3, at(8)}, {"a", 1, at(0)}}, []spotSegment{{1, 8}, {3, 2}}},
+	}
+	for _, tt := range tests {
+		got := spotSegments(tt.points, at(0), at(10))
+		// zones come out in map order, compare by price
+		sort.Slice(got, func(a, b int) bool { return got[a].price < got[b].price })
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSpotStats(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []SpotPricePoint
+		start  time.Time
+		want   SpotStats
+		ok     bool
+	}{
+		{
+			// a: 5 for 2h, 1 for 6h, 3 for 2h; b: 2 for 10h
+			"time weighted over zones",
+			[]SpotPricePoint{{"a", 5, at(-10)}, {"a", 1, at(2)}, {"a", 3, at(8)}, {"b", 2, at(0)}, {"b", 9, at(-20)}},
+			at(0),
+			SpotStats{Min: 1, Max: 5, Mean: 2.1, P95: 5, StdDev: math.Sqrt(1.29)},
+			true,
+		},
+		{
+			// a short spike doesn't move the P95 of a price that held for the rest of the window
+			"short spike",
+			[]SpotPricePoint{{"a", 1, at(0)}, {"a", 10, at(9)}, {"a", 1, at(9).Add(30 * time.Minute)}},
+			at(0),
+			SpotStats{Min: 1, Max: 10, Mean: 1.45, P95: 1, StdDev: math.Sqrt(0.05 * 0.95 * 81)},
+			true,
+		},
+		{
+			"spike over 5% of the window",
+			[]SpotPricePoint{{"a", 1, at(0)}, {"a", 10, at(9)}},
+			at(0),
+			SpotStats{Min: 1, Max: 10, Mean: 1.9, P95: 10, StdDev: 2.7},
+			true,
+		},
+		{"a single instant counts once", []SpotPricePoint{{"a", 4, at(10)}}, at(10), SpotStats{Min: 4, Max: 4, Mean: 4, P95: 4}, true},
+		{"nothing in the window", []SpotPricePoint{{"a", 4, at(11)}}, at(0), SpotStats{}, false},
+		{"no points", nil, at(0), SpotStats{}, false},
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	for _, tt := range tests {
+		got, ok := spotStats(tt.points, tt.start, at(10))
+		if ok != tt.ok || !near(got.Min, tt.want.Min) || !near(got.Max, tt.want.Max) || !near(got.Mean, tt.want.Mean) ||
+			!near(got.P95, tt.want.P95) || !near(got.StdDev, tt.want.StdDev) {
+			t.Errorf("%s: got %+v %v, want %+v %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// TestGetSpotHistoryJoin checks the history is joined on its own series, not only onto instances spot.js prices.
+func TestGetSpotHistoryJoin(t *testing.T) {
+	var ec2 Ec2
+	if err := parseOffer(strings.NewReader(testOffer(false)), &ec2, newOfferFilter(""), 1); err != nil {
+		t.Fatal(err)
+	}
+	ec2.Instance[0].SpotPrice = 0.035 // m5.large in us-east-1, D in eu-west-1 has none
+	dir := t.TempDir()
+	history := `{"SpotPriceHistory": [
+		{"AvailabilityZone": "us-east-1a", "InstanceType": "m5.large", "ProductDescription": "Linux/UNIX", "SpotPrice": "0.035", "Timestamp": "2024-01-01T00:00:00.000Z"},
+		{"AvailabilityZone": "eu-west-1b", "InstanceType": "m5.large", "ProductDescription": "Linux/UNIX", "SpotPrice": "0.04", "Timestamp": "2024-01-01T00:00:00.000Z"}
+	]}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "history.json"), []byte(history), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := getSpotHistory(&ec2, &fixtureSource{dir: dir}, "history.json", 24*time.Hour, false, false); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"A": "us-east-1a", "D": "eu-west-1b"}
+	for _, i := range ec2.Instance {
+		zone := ""
+		if len(i.SpotZones) > 0 && i.SpotHistory != nil {
+			zone = i.SpotZones[0].Zone
+		}
+		if zone != want[i.Sku] {
+			t.Errorf("%s: got zone %q, want %q", i.Sku, zone, want[i.Sku])
+		}
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"7d", 7 * 24 * time.Hour, true},
+		{"1.5d", 36 * time.Hour, true},
+		{"36h", 36 * time.Hour, true},
+		{"90m", 90 * time.Minute, true},
+		{"0d", 0, false},
+		{"-1h", 0, false},
+		{"d", 0, false},
+		{"week", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseWindow(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("%q: got %v %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestZoneRegion(t *testing.T) {
+	tests := map[string]string{
+		"us-east-1a":       "us-east-1",
+		"eu-west-1c":       "eu-west-1",
+		"us-east-1-bos-1a": "us-east-1-bos-1",
+		"us-east-1":        "us-east-1",
+	}
+	for in, want := range tests {
+		if got := zoneRegion(in); got != want {
+			t.Errorf("%q: got %q, want %q", in, got, want)
+		}
+	}
+}
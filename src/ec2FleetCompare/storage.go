@@ -0,0 +1,70 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+The storage attribute describes instance store as "<count> x <size> <media>", i.e. "1 x 1900 NVMe SSD",
+"24 x 13980 HDD" or "2 x 320 SSD", older generations without the media ("1 x 160", spinning disks) and a few newer
+ones as a single total ("900 GB NVMe SSD"). Sizes are in GB and can have decimals. Anything without instance store
+says "EBS only".
+*/
+
+var r_storage = regexp.MustCompile(`(?i)^\s*(?:(\d+)\s*x\s*)?(\d+(?:\.\d+)?)\s*(?:GB)?\s*(NVMe\s+SSD|SSD|HDD)?`)
+
+// setStorage fills in the instance store specs of i from its storage attribute.
+func setStorage(i *Instance, storage string) {
+	i.Specs.DiskCount, i.Specs.DiskSizeEach, i.Specs.DiskSize = 0, 0, 0
+	if storage == "" || strings.EqualFold(storage, "EBS only") || strings.EqualFold(storage, "NA") {
+		i.Specs.DiskType = "EBS"
+		return
+	}
+	m := r_storage.FindStringSubmatch(storage)
+	if m == nil {
+		i.Specs.DiskType = "EBS"
+		return
+	}
+
+	count := 1
+	if m[1] != "" {
+		count, _ = strconv.Atoi(m[1])
+	}
+	size, _ := strconv.ParseFloat(m[2], 64)
+	i.Specs.DiskCount = count
+	i.Specs.DiskSizeEach = size
+	i.Specs.DiskSize = int(size * float64(count))
+
+	switch media := strings.ToUpper(strings.Join(strings.Fields(m[3]), " ")); media {
+	case "NVME SSD":
+		i.Specs.DiskType = "NVMe SSD"
+	case "SSD", "HDD":
+		i.Specs.DiskType = media
+	default:
+		// the oldest generations only give a size, their instance store was spinning disk
+		i.Specs.DiskType = "HDD"
+	}
+}
+
+// matchesDiskType reports whether the instance store of s is of the --diskType option, NVMe drives are SSDs too.
+func (s InstanceSpecs) matchesDiskType(diskType string) bool {
+	switch diskType {
+	case "ANY":
+		return true
+	case "NVME":
+		return s.DiskType == "NVMe SSD"
+	case "SSD":
+		return s.DiskType == "SSD" || s.DiskType == "NVMe SSD"
+	}
+	return strings.ToUpper(s.DiskType) == diskType
+}
+
+// diskLayout describes the instance store of s for display i.e. "2 x 1900 GB".
+func (s InstanceSpecs) diskLayout() string {
+	if s.DiskCount == 0 {
+		return ""
+	}
+	return strconv.Itoa(s.DiskCount) + " x " + strconv.FormatFloat(s.DiskSizeEach, 'f', -1, 64) + " GB"
+}
@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func TestSetStorage(t *testing.T) {
+	tests := []struct {
+		in     string
+		typ    string
+		count  int
+		total  int
+		layout string
+	}{
+		{"2 x 1900 NVMe SSD", "NVMe SSD", 2, 3800, "2 x 1900 GB"},
+		{"1 x 1900 nvme  ssd", "NVMe SSD", 1, 1900, "1 x 1900 GB"},
+		{"2 x 320 SSD", "SSD", 2, 640, "2 x 320 GB"},
+		{"24 x 13980 HDD", "HDD", 24, 335520, "24 x 13980 GB"},
+		{"1 x 160", "HDD", 1, 160, "1 x 160 GB"},
+		{"900 GB NVMe SSD", "NVMe SSD", 1, 900, "1 x 900 GB"},
+		{"1 x 0.475 NVMe SSD", "NVMe SSD", 1, 0, "1 x 0.475 GB"},
+		{"EBS only", "EBS", 0, 0, ""},
+		{"NA", "EBS", 0, 0, ""},
+		{"", "EBS", 0, 0, ""},
+		{"unknown", "EBS", 0, 0, ""},
+	}
+	for _, tt := range tests {
+		// a previous value must not leak through
+		i := Instance{Specs: InstanceSpecs{DiskCount: 9, DiskSize: 9}}
+		setStorage(&i, tt.in)
+		s := i.Specs
+		if s.DiskType != tt.typ || s.DiskCount != tt.count || s.DiskSize != tt.total || s.diskLayout() != tt.layout {
+			t.Errorf("%q: got %q %d %d %q, want %q %d %d %q", tt.in, s.DiskType, s.DiskCount, s.DiskSize, s.diskLayout(), tt.typ, tt.count, tt.total, tt.layout)
+		}
+	}
+}
+
+func TestMatchesDiskType(t *testing.T) {
+	tests := []struct {
+		typ  string
+		opt  string
+		want bool
+	}{
+		{"NVMe SSD", "ANY", true},
+		{"NVMe SSD", "NVME", true},
+		{"NVMe SSD", "SSD", true},
+		{"SSD", "NVME", false},
+		{"SSD", "SSD", true},
+		{"HDD", "SSD", false},
+		{"HDD", "HDD", true},
+		{"EBS", "EBS", true},
+	}
+	for _, tt := range tests {
+		if got := (InstanceSpecs{DiskType: tt.typ}).matchesDiskType(tt.opt); got != tt.want {
+			t.Errorf("%s %s: got %v", tt.typ, tt.opt, got)
+		}
+	}
+}
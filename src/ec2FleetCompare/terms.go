@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+)
+
+/*
+Offer terms are read from what they describe rather than from their codes: termAttributes says how long a
+reservation runs, how it is paid for and whether it is convertible, and each priceDimension's unit says whether it
+is a recurring hourly rate ("Hrs") or a one-off payment ("Quantity"). Any term AWS adds is picked up as-is.
+*/
+
+// Reservation is one reserved instance offer for an instance.
+type Reservation struct {
+	LeaseContractLength string  // "1yr", "3yr"
+	PurchaseOption      string  // "No Upfront", "Partial Upfront", "All Upfront"
+	OfferingClass       string  // "standard", "convertible"
+	Upfront             float64 // one-off payment per instance
+	Hourly              float64 // recurring price per instance hour
+}
+
+// Months is the length of the reservation in months.
+func (r Reservation) Months() int {
+	switch r.LeaseContractLength {
+	case "1yr":
+		return 12
+	case "3yr":
+		return 36
+	}
+	return 0
+}
+
+var purchaseOptionOrder = map[string]int{"No Upfront": 0, "Partial Upfront": 1, "All Upfront": 2}
+
+// findReservation looks up the offer matching length, option and class.
+func findReservation(reservations []Reservation, length string, option string, class string) (Reservation, bool) {
+	for _, r := range reservations {
+		if r.LeaseContractLength == length && r.PurchaseOption == option && r.OfferingClass == class {
+			return r, true
+		}
+	}
+	return Reservation{}, false
+}
+
+// riTypes maps the --riType options onto the reservation they select, conv- picks the convertible offer.
+var riTypes = map[string]Reservation{
+	"zero1":         {LeaseContractLength: "1yr", PurchaseOption: "No Upfront", OfferingClass: "standard"},
+	"partial1":      {LeaseContractLength: "1yr", PurchaseOption: "Partial Upfront", OfferingClass: "standard"},
+	"full1":         {LeaseContractLength: "1yr", PurchaseOption: "All Upfront", OfferingClass: "standard"},
+	"zero3":         {LeaseContractLength: "3yr", PurchaseOption: "No Upfront", OfferingClass: "standard"},
+	"partial3":      {LeaseContractLength: "3yr", PurchaseOption: "Partial Upfront", OfferingClass: "standard"},
+	"full3":         {LeaseContractLength: "3yr", PurchaseOption: "All Upfront", OfferingClass: "standard"},
+	"conv-zero1":    {LeaseContractLength: "1yr", PurchaseOption: "No Upfront", OfferingClass: "convertible"},
+	"conv-partial1": {LeaseContractLength: "1yr", PurchaseOption: "Partial Upfront", OfferingClass: "convertible"},
+	"conv-full1":    {LeaseContractLength: "1yr", PurchaseOption: "All Upfront", OfferingClass: "convertible"},
+	"conv-zero3":    {LeaseContractLength: "3yr", PurchaseOption: "No Upfront", OfferingClass: "convertible"},
+	"conv-partial3": {LeaseContractLength: "3yr", PurchaseOption: "Partial Upfront", OfferingClass: "convertible"},
+	"conv-full3":    {LeaseContractLength: "3yr", PurchaseOption: "All Upfront", OfferingClass: "convertible"},
+}
+
+// applyTerms copies the prices found in one SKU's terms of termType onto i.
+func applyTerms(i *Instance, termType string, terms map[string]offerTerm) {
+	for _, term := range terms {
+		var hourly, upfront float64
+		for _, dimension := range term.PriceDimensions {
+			price, err := strconv.ParseFloat(dimension.PricePerUnit["USD"], 64)
+			if err != nil {
+				continue
+			}
+			switch dimension.Unit {
+			case "Hrs":
+				hourly += price
+			case "Quantity":
+				upfront += price
+			}
+		}
+
+		switch termType {
+		case "OnDemand":
+			i.DemandPrice = hourly
+		case "Reserved":
+			r := Reservation{
+				LeaseContractLength: term.TermAttributes["LeaseContractLength"],
+				PurchaseOption:      term.TermAttributes["PurchaseOption"],
+				OfferingClass:       term.TermAttributes["OfferingClass"],
+				Upfront:             upfront,
+				Hourly:              hourly,
+			}
+			// legacy "Heavy Utilization" style terms have no contract length we can amortise over
+			if r.Months() == 0 {
+				continue
+			}
+			i.Reservations = append(i.Reservations, r)
+		}
+	}
+
+	// terms arrive in map order, keep the list stable for the cache and display
+	sort.Slice(i.Reservations, func(a, b int) bool {
+		ra, rb := i.Reservations[a], i.Reservations[b]
+		if ra.LeaseContractLength != rb.LeaseContractLength {
+			return ra.LeaseContractLength < rb.LeaseContractLength
+		}
+		if ra.OfferingClass != rb.OfferingClass {
+			return ra.OfferingClass > rb.OfferingClass
+		}
+		return purchaseOptionOrder[ra.PurchaseOption] < purchaseOptionOrder[rb.PurchaseOption]
+	})
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+--where takes a boolean expression over the fields of a result, for the constraints the flags don't cover:
+
+	mem/vcpu >= 8 && network_gbps >= 25 && spot_savings > 60
+	category =~ "memory" || (gpu > 0 && !current)
+
+Fields are listed in whereFields with their type: numbers, strings or booleans. Numbers support + - * / and
+< <= > >= == !=, strings == != and =~ (a case insensitive regular expression match), booleans && || and !. The
+expression is parsed and type checked once, before any prices are fetched, so a typo or a comparison of a string
+with a number is reported straight away. A price a result doesn't have (spot_hour of an instance without spot) is
+NaN and fails any comparison, != included. Negating the comparison lets it through: !(spot_hour > 0.1) is true of an
+instance without spot, write spot_hour <= 0.1 to leave those out.
+*/
+
+type whereType int
+
+const (
+	whereNumber whereType = iota
+	whereString
+	whereBool
+)
+
+func (t whereType) String() string {
+	switch t {
+	case whereNumber:
+		return "number"
+	case whereString:
+		return "string"
+	}
+	return "bool"
+}
+
+// whereField is a field --where can refer to.
+type whereField struct {
+	typ  whereType
+	desc string
+	get  func(f Ec2Filtered) interface{} // float64, string or bool as typ
+}
+
+func numberField(desc string, get func(f Ec2Filtered) float64) whereField {
+	return whereField{whereNumber, desc, func(f Ec2Filtered) interface{} { return get(f) }}
+}
+
+func stringField(desc string, get func(f Ec2Filtered) string) whereField {
+	return whereField{whereString, desc, func(f Ec2Filtered) interface{} { return get(f) }}
+}
+
+func boolField(desc string, get func(f Ec2Filtered) bool) whereField {
+	return whereField{whereBool, desc, func(f Ec2Filtered) interface{} { return get(f) }}
+}
+
+// hourly and monthly read a price under a pricing model, NaN if the result has none.
+func hourly(model string) func(f Ec2Filtered) float64 {
+	return func(f Ec2Filtered) float64 {
+		if p, ok := f.hourlyPrice(model); ok {
+			return p
+		}
+		return math.NaN()
+	}
+}
+
+func monthly(model string) func(f Ec2Filtered) float64 {
+	return func(f Ec2Filtered) float64 {
+		if p, ok := f.monthlyPrice(model); ok {
+			return p
+		}
+		return math.NaN()
+	}
+}
+
+var whereFields = map[string]whereField{
+	"name":                  stringField("instance type i.e. m5.large", func(f Ec2Filtered) string { return f.Instance.Name }),
+	"family":                stringField("instance family i.e. m5", func(f Ec2Filtered) string { return instanceFamily(f.Instance.Name) }),
+	"category":              stringField("General purpose, Compute optimized ...", func(f Ec2Filtered) string { return f.Instance.Specs.Category }),
+	"current":               boolField("current generation", func(f Ec2Filtered) bool { return f.Instance.Specs.CurrentGeneration }),
+	"region":                stringField("region code", func(f Ec2Filtered) string { return f.Instance.RegionCode }),
+	"tenancy":               stringField("Shared, Dedicated or Host", func(f Ec2Filtered) string { return f.Instance.Tenancy }),
+	"os":                    stringField("operating system", func(f Ec2Filtered) string { return f.Instance.Specs.Os }),
+	"software":              stringField("pre-installed software, NA for none", func(f Ec2Filtered) string { return f.Instance.Specs.Software }),
+	"vcpu":                  numberField("vCPUs", func(f Ec2Filtered) float64 { return float64(f.Instance.Specs.Cpu) }),
+	"mem":                   numberField("memory in GiB", func(f Ec2Filtered) float64 { return f.Instance.Specs.Mem }),
+	"arch":                  stringField("x86_64 or arm64", func(f Ec2Filtered) string { return f.Instance.Specs.Arch }),
+	"vendor":                stringField("Intel, AMD, AWS, Apple", func(f Ec2Filtered) string { return f.Instance.Specs.Vendor }),
+	"processor":             stringField("physical processor", func(f Ec2Filtered) string { return f.Instance.Specs.Processor }),
+	"gpu":                   numberField("GPUs", func(f Ec2Filtered) float64 { return float64(f.Instance.Specs.Gpu) }),
+	"gpu_mem":               numberField("GPU memory in GiB", func(f Ec2Filtered) float64 { return f.Instance.Specs.GpuMem }),
+	"accelerator":           stringField("accelerator model i.e. NVIDIA V100", func(f Ec2Filtered) string { return f.Instance.Specs.Accelerator }),
+	"disk":                  numberField("instance store in GB", func(f Ec2Filtered) float64 { return float64(f.Instance.Specs.DiskSize) }),
+	"disk_count":            numberField("instance store disks", func(f Ec2Filtered) float64 { return float64(f.Instance.Specs.DiskCount) }),
+	"disk_type":             stringField("NVMe SSD, SSD, HDD or EBS", func(f Ec2Filtered) string { return f.Instance.Specs.DiskType }),
+	"network_gbps":          numberField("network rating in Gbps", func(f Ec2Filtered) float64 { return f.Instance.Specs.NetworkBurstGbps }),
+	"network_baseline_gbps": numberField("sustained network in Gbps", func(f Ec2Filtered) float64 { return f.Instance.Specs.NetworkBaselineGbps }),
+	"instances":             numberField("instances in the fleet", func(f Ec2Filtered) float64 { return float64(f.NumberInstances) }),
+	"demand_hour":           numberField("on demand price per instance hour", hourly("demand")),
+	"spot_hour":             numberField("spot price per instance hour", hourly("spot")),
+	"ri_hour":               numberField("effective RI price per instance hour", hourly("ri")),
+	"sp_hour":               numberField("savings plan price per instance hour", hourly("sp")),
+	"demand_month":          numberField("on demand cost of the fleet per month", monthly("demand")),
+	"spot_month":            numberField("spot cost of the fleet per month", monthly("spot")),
+	"ri_month":              numberField("RI cost of the fleet per month", monthly("ri")),
+	"sp_month":              numberField("savings plan cost of the fleet per month", monthly("sp")),
+	"spot_savings": numberField("spot saving over on demand in %", func(f Ec2Filtered) float64 {
+		spot, ok := f.monthlyPrice("spot")
+		if !ok || f.TotalPriceDemand <= 0 {
+			return math.NaN()
+		}
+		return (f.TotalPriceDemand - spot) / f.TotalPriceDemand * 100
+	}),
+	"clock_ghz":     numberField("clock speed in GHz", func(f Ec2Filtered) float64 { return f.Instance.Specs.ClockGHz }),
+	"ecu":           numberField("EC2 compute units, 0 for burstable", func(f Ec2Filtered) float64 { return f.Instance.Specs.Ecu }),
+	"mem_per_vcpu":  numberField("GiB of memory per vCPU", func(f Ec2Filtered) float64 { return f.MemPerVcpu }),
+	"vcpu_hour":     numberField("--metric-price per vCPU hour", func(f Ec2Filtered) float64 { return f.VcpuHour }),
+	"gib_hour":      numberField("--metric-price per GiB hour", func(f Ec2Filtered) float64 { return f.GiBHour }),
+	"ecu_hour":      numberField("--metric-price per ECU hour", func(f Ec2Filtered) float64 { return f.EcuHour }),
+	"ghz_hour":      numberField("--metric-price per GHz-core hour", func(f Ec2Filtered) float64 { return f.GHzCoreHour }),
+	"burstable":     boolField("T family, earns and spends CPU credits", func(f Ec2Filtered) bool { return f.Instance.Specs.Burstable }),
+	"baseline":      numberField("burstable baseline per vCPU in %, 0 otherwise", func(f Ec2Filtered) float64 { return f.Instance.Specs.BaselinePerVcpu * 100 }),
+	"credits_hour":  numberField("CPU credits a burstable instance earns an hour", func(f Ec2Filtered) float64 { return f.Instance.Specs.CreditsPerHour }),
+	"surplus_month": numberField("unlimited mode surplus credit charges of the fleet per month", func(f Ec2Filtered) float64 { return f.SurplusMonthly }),
+	"interruption": numberField("spot interruption frequency in %, the top of the advisor's band", func(f Ec2Filtered) float64 {
+		if f.Instance.Interruption == nil {
+			return math.NaN()
+		}
+		return f.Instance.Interruption.Max
+	}),
+	"interruption_band": stringField("spot interruption band i.e. <5%, N/A if unknown", func(f Ec2Filtered) string { return f.Instance.interruptionDesc() }),
+	"spot_min":          numberField("lowest spot price per instance hour over --history-window", historyHourly(func(s SpotStats) float64 { return s.Min })),
+	"spot_mean":         numberField("time weighted mean spot price per instance hour", historyHourly(func(s SpotStats) float64 { return s.Mean })),
+	"spot_p95":          numberField("spot price per instance hour not exceeded 95% of the time", historyHourly(func(s SpotStats) float64 { return s.P95 })),
+	"spot_max":          numberField("highest spot price per instance hour over --history-window", historyHourly(func(s SpotStats) float64 { return s.Max })),
+	"spot_stddev":       numberField("standard deviation of the spot price per instance hour", historyHourly(func(s SpotStats) float64 { return s.StdDev })),
+	"az_count":          numberField("availability zones with a spot price in --spot-history", func(f Ec2Filtered) float64 { return float64(len(f.Instance.SpotZones)) }),
+	"az_spread":         numberField("spot price of the dearest zone over the cheapest in %", func(f Ec2Filtered) float64 { return f.Instance.zoneSpread() }),
+	"cheapest_az": stringField("zone with the lowest spot price, empty if unknown", func(f Ec2Filtered) string {
+		if len(f.Instance.SpotZones) == 0 {
+			return ""
+		}
+		return f.Instance.SpotZones[0].Zone
+	}),
+	"license_premium": numberField("license cost per instance hour over the base OS", func(f Ec2Filtered) float64 { return f.Instance.LicensePremium }),
+}
+
+// whereFieldNames lists the fields for help and error output.
+func whereFieldNames() []string {
+	var names []string
+	for name := range whereFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// whereNode is a type checked node of a --where expression.
+type whereNode interface {
+	typ() whereType
+	eval(f Ec2Filtered) interface{}
+}
+
+// WhereExpr is a compiled --where expression.
+type WhereExpr struct {
+	source string
+	root   whereNode
+}
+
+// Match reports whether f satisfies the expression, a nil expression matches everything.
+func (w *WhereExpr) Match(f Ec2Filtered) bool {
+	if w == nil {
+		return true
+	}
+	return w.root.eval(f).(bool)
+}
+
+type whereLiteral struct {
+	t     whereType
+	value interface{}
+}
+
+func (n whereLiteral) typ() whereType                 { return n.t }
+func (n whereLiteral) eval(f Ec2Filtered) interface{} { return n.value }
+
+type whereFieldRef struct{ field whereField }
+
+func (n whereFieldRef) typ() whereType                 { return n.field.typ }
+func (n whereFieldRef) eval(f Ec2Filtered) interface{} { return n.field.get(f) }
+
+type whereUnary struct {
+	op      string
+	operand whereNode
+}
+
+func (n whereUnary) typ() whereType { return n.operand.typ() }
+func (n whereUnary) eval(f Ec2Filtered) interface{} {
+	if n.op == "!" {
+		return !n.operand.eval(f).(bool)
+	}
+	return -n.operand.eval(f).(float64)
+}
+
+type whereBinary struct {
+	op          string
+	left, right whereNode
+	t           whereType
+	re          *regexp.Regexp // for =~ against a literal
+}
+
+func (n whereBinary) typ() whereType { return n.t }
+func (n whereBinary) eval(f Ec2Filtered) interface{} {
+	switch n.op {
+	case "&&":
+		return n.left.eval(f).(bool) && n.right.eval(f).(bool)
+	case "||":
+		return n.left.eval(f).(bool) || n.right.eval(f).(bool)
+	}
+
+	l, r := n.left.eval(f), n.right.eval(f)
+	switch n.left.typ() {
+	case whereNumber:
+		a, b := l.(float64), r.(float64)
+		switch n.op {
+		case "+":
+			return a + b
+		case "-":
+			return a - b
+		case "*":
+			return a * b
+		case "/":
+			return a / b
+		case "<":
+			return a < b
+		case "<=":
+			return a <= b
+		case ">":
+			return a > b
+		case ">=":
+			return a >= b
+		case "==":
+			return a == b
+		case "!=":
+			// NaN is unequal to everything, a missing price must not pass because of it
+			return !math.IsNaN(a) && !math.IsNaN(b) && a != b
+		}
+	case whereString:
+		a, b := l.(string), r.(string)
+		switch n.op {
+		case "==":
+			return strings.EqualFold(a, b)
+		case "!=":
+			return !strings.EqualFold(a, b)
+		case "=~":
+			if n.re != nil {
+				return n.re.MatchString(a)
+			}
+			re, err := regexp.Compile(`(?i)` + b)
+			return err == nil && re.MatchString(a)
+		}
+	case whereBool:
+		a, b := l.(bool), r.(bool)
+		switch n.op {
+		case "==":
+			return a == b
+		case "!=":
+			return a != b
+		}
+	}
+	panic("where: unchecked operator " + n.op)
+}
+
+type whereToken struct {
+	kind string // "num", "str", "ident", "op", "eof"
+	text string
+	pos  int
+}
+
+var whereOps = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "<", ">", "!", "+", "-", "*", "/", "(", ")"}
+
+func whereLex(s string) ([]whereToken, error) {
+	var tokens []whereToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, whereToken{"num", s[i:j], i})
+			i = j
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z' || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, whereToken{"ident", s[i:j], i})
+			i = j
+		case c == '"' || c == '\'':
+			j := strings.IndexByte(s[i+1:], c)
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated string at column %d", i+1)
+			}
+			tokens = append(tokens, whereToken{"str", s[i+1 : i+1+j], i})
+			i += j + 2
+		default:
+			op := ""
+			for _, o := range whereOps {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at column %d", c, i+1)
+			}
+			tokens = append(tokens, whereToken{"op", op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, whereToken{"eof", "", len(s)}), nil
+}
+
+type whereParser struct {
+	tokens []whereToken
+	pos    int
+}
+
+func (p *whereParser) peek() whereToken { return p.tokens[p.pos] }
+func (p *whereParser) next() whereToken {
+	t := p.tokens[p.pos]
+	if t.kind != "eof" {
+		p.pos++
+	}
+	return t
+}
+
+// binary levels from loosest to tightest, each parsed by parseLevel
+var whereLevels = [][]string{{"||"}, {"&&"}, {"==", "!=", "<", "<=", ">", ">=", "=~"}, {"+", "-"}, {"*", "/"}}
+
+func (p *whereParser) parseLevel(level int) (whereNode, error) {
+	if level == len(whereLevels) {
+		return p.parseUnary()
+	}
+	left, err := p.parseLevel(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != "op" || !contains(whereLevels[level], t.text) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseLevel(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		if left, err = checkBinary(t, left, right); err != nil {
+			return nil, err
+		}
+		// comparisons don't chain, a < b < c is a mistake
+		if level == 2 {
+			if n := p.peek(); n.kind == "op" && contains(whereLevels[level], n.text) {
+				return nil, fmt.Errorf("comparisons can't be chained, %q at column %d", n.text, n.pos+1)
+			}
+		}
+	}
+}
+
+func (p *whereParser) parseUnary() (whereNode, error) {
+	t := p.next()
+	switch t.kind {
+	case "num":
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q at column %d", t.text, t.pos+1)
+		}
+		return whereLiteral{whereNumber, v}, nil
+	case "str":
+		return whereLiteral{whereString, t.text}, nil
+	case "ident":
+		switch strings.ToLower(t.text) {
+		case "true":
+			return whereLiteral{whereBool, true}, nil
+		case "false":
+			return whereLiteral{whereBool, false}, nil
+		}
+		field, ok := whereFields[strings.ToLower(t.text)]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q at column %d, fields: %s", t.text, t.pos+1, strings.Join(whereFieldNames(), ", "))
+		}
+		return whereFieldRef{field}, nil
+	case "op":
+		switch t.text {
+		case "(":
+			n, err := p.parseLevel(0)
+			if err != nil {
+				return nil, err
+			}
+			if c := p.next(); c.text != ")" || c.kind != "op" {
+				return nil, fmt.Errorf("missing ) for the ( at column %d", t.pos+1)
+			}
+			return n, nil
+		case "!", "-":
+			operand, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			want := whereBool
+			if t.text == "-" {
+				want = whereNumber
+			}
+			if operand.typ() != want {
+				return nil, fmt.Errorf("%s needs a %s at column %d, not a %s", t.text, want, t.pos+1, operand.typ())
+			}
+			return whereUnary{t.text, operand}, nil
+		}
+	case "eof":
+		return nil, fmt.Errorf("expression ends too early")
+	}
+	return nil, fmt.Errorf("unexpected %q at column %d", t.text, t.pos+1)
+}
+
+// checkBinary type checks the operator t applied to left and right.
+func checkBinary(t whereToken, left whereNode, right whereNode) (whereNode, error) {
+	if left.typ() != right.typ() {
+		return nil, fmt.Errorf("%q at column %d compares a %s with a %s", t.text, t.pos+1, left.typ(), right.typ())
+	}
+	n := whereBinary{op: t.text, left: left, right: right, t: whereBool}
+	allowed := map[whereType][]string{
+		whereNumber: {"+", "-", "*", "/", "<", "<=", ">", ">=", "==", "!="},
+		whereString: {"==", "!=", "=~"},
+		whereBool:   {"&&", "||", "==", "!="},
+	}[left.typ()]
+	if !contains(allowed, t.text) {
+		return nil, fmt.Errorf("%q at column %d can't be used on a %s", t.text, t.pos+1, left.typ())
+	}
+	switch t.text {
+	case "+", "-", "*", "/":
+		n.t = whereNumber
+	case "=~":
+		if lit, ok := right.(whereLiteral); ok {
+			re, err := regexp.Compile(`(?i)` + lit.value.(string))
+			if err != nil {
+				return nil, fmt.Errorf("bad regular expression at column %d: %v", t.pos+1, err)
+			}
+			n.re = re
+		}
+	}
+	return n, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWhere compiles a --where expression, an empty one gives nil which matches everything.
+func parseWhere(s string) (*WhereExpr, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	tokens, err := whereLex(s)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid --where: %v", err)
+	}
+	p := &whereParser{tokens: tokens}
+	root, err := p.parseLevel(0)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid --where: %v", err)
+	}
+	if t := p.peek(); t.kind != "eof" {
+		return nil, fmt.Errorf("Invalid --where: unexpected %q at column %d", t.text, t.pos+1)
+	}
+	if root.typ() != whereBool {
+		return nil, fmt.Errorf("Invalid --where: the expression is a %s, it must be true or false i.e. vcpu >= 8", root.typ())
+	}
+	return &WhereExpr{source: s, root: root}, nil
+}
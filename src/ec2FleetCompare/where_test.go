@@ -0,0 +1,123 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWhereLex(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string // kind:text
+		err  string
+	}{
+		{"vcpu>=8", []string{"ident:vcpu", "op:>=", "num:8", "eof:"}, ""},
+		{"mem/vcpu <= 0.5", []string{"ident:mem", "op:/", "ident:vcpu", "op:<=", "num:0.5", "eof:"}, ""},
+		{`name =~ 'm5' && !current`, []string{"ident:name", "op:=~", "str:m5", "op:&&", "op:!", "ident:current", "eof:"}, ""},
+		{`family == "r6g"`, []string{"ident:family", "op:==", "str:r6g", "eof:"}, ""},
+		{"a!=b", []string{"ident:a", "op:!=", "ident:b", "eof:"}, ""},
+		{`name == "m5`, nil, "unterminated string at column 9"},
+		{"vcpu # 8", nil, "unexpected '#' at column 6"},
+	}
+	for _, tt := range tests {
+		tokens, err := whereLex(tt.in)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%q: got error %v, want %q", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		var got []string
+		for _, tok := range tokens {
+			got = append(got, tok.kind+":"+tok.text)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseWhereErrors(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // part of the error
+	}{
+		{"vcpu >= ", "expression ends too early"},
+		{"vcpu >= 8)", `unexpected ")" at column 10`},
+		{"(vcpu >= 8", "missing ) for the ( at column 1"},
+		{"cpus >= 8", `unknown field "cpus" at column 1`},
+		{`vcpu == "8"`, `"==" at column 6 compares a number with a string`},
+		{`name < "m5"`, `"<" at column 6 can't be used on a string`},
+		{"current + 1", "compares a bool with a number"},
+		{"current && vcpu", "compares a bool with a number"},
+		{"!vcpu", "! needs a bool at column 1, not a number"},
+		{`-name == "x"`, "- needs a number at column 1, not a string"},
+		{"1 < vcpu < 8", `comparisons can't be chained, "<" at column 10`},
+		{"vcpu + 1", "the expression is a number"},
+		{`name =~ "("`, "bad regular expression at column 6"},
+		{"1..2 > 0", `bad number "1..2" at column 1`},
+	}
+	for _, tt := range tests {
+		_, err := parseWhere(tt.in)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got error %v, want %q", tt.in, err, tt.want)
+		}
+	}
+	if w, err := parseWhere("  "); w != nil || err != nil {
+		t.Errorf("empty: got %v %v, want nil", w, err)
+	}
+}
+
+func TestWhereMatch(t *testing.T) {
+	spot := Ec2Filtered{
+		NumberInstances:  2,
+		TotalPriceDemand: 144,
+		TotalPriceSpot:   72,
+		TotalPriceRI:     999999999.999999,
+		Instance: Instance{
+			Name:       "m5.large",
+			RegionCode: "us-east-1",
+			SpotPrice:  0.05,
+			Specs:      InstanceSpecs{Cpu: 2, Mem: 8, CurrentGeneration: true, Category: "General purpose"},
+		},
+	}
+	noSpot := spot
+	noSpot.Instance.SpotPrice = 999999.9
+	tests := []struct {
+		expr   string
+		f      Ec2Filtered
+		want   bool
+		reason string
+	}{
+		{"mem/vcpu >= 4 && current", spot, true, "arithmetic and bools"},
+		{"vcpu * 2 + 1 == 5", spot, true, "* binds tighter than +"},
+		{"vcpu > 1 || vcpu > 100 && false", spot, true, "&& binds tighter than ||"},
+		{"(vcpu > 1 || vcpu > 100) && false", spot, false, "parentheses"},
+		{"-vcpu < 0", spot, true, "unary minus"},
+		{`family == "M5" && category =~ "general"`, spot, true, "strings compare case insensitively"},
+		{`name != "m5.large"`, spot, false, "string !="},
+		{"current != false", spot, true, "bool !="},
+		{"spot_hour == 0.05", spot, true, "hourly price per instance"},
+		{"spot_savings == 50", spot, true, "spot saving"},
+		{"spot_hour > 0.01", noSpot, false, "a missing price fails a comparison"},
+		{"spot_hour != 0.05", noSpot, false, "a missing price fails != too"},
+		{"ri_hour != 1", spot, false, "a missing RI price fails !="},
+		{"!(spot_hour > 0.1)", noSpot, true, "negation lets a missing price through"},
+		{"spot_hour <= 0.1", noSpot, false, "write the comparison the other way round instead"},
+	}
+	for _, tt := range tests {
+		w, err := parseWhere(tt.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if got := w.Match(tt.f); got != tt.want {
+			t.Errorf("%q (%s): got %v, want %v", tt.expr, tt.reason, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+Spot prices differ between the availability zones of a region, spot.js only gives one per region. With --spot-history
+each instance also carries the latest price of every zone it is sold in, which gives the cheapest zone and the spread
+between the cheapest and the dearest. --azs N places the fleet across the N cheapest zones, as evenly as it divides
+with the odd instances in the cheaper ones, and prices spot from the zone prices actually used. A fleet spread across
+N zones takes at least N instances, a fleet sized by the targets is raised to that and a --num below it is refused,
+and an instance sold in fewer zones can't be spread that way.
+*/
+
+// ZonePrice is the latest spot price of an instance in one availability zone.
+type ZonePrice struct {
+	Zone  string
+	Price float64
+}
+
+// latestZonePrices is the last price of every zone in points, cheapest first.
+func latestZonePrices(points []SpotPricePoint) []ZonePrice {
+	latest := make(map[string]SpotPricePoint)
+	for _, p := range points {
+		if l, ok := latest[p.Zone]; !ok || p.Time.After(l.Time) {
+			latest[p.Zone] = p
+		}
+	}
+	var zones []ZonePrice
+	for zone, p := range latest {
+		zones = append(zones, ZonePrice{zone, p.Price})
+	}
+	sort.Slice(zones, func(a, b int) bool {
+		if zones[a].Price != zones[b].Price {
+			return zones[a].Price < zones[b].Price
+		}
+		return zones[a].Zone < zones[b].Zone
+	})
+	return zones
+}
+
+// zoneSpread is how much dearer the dearest zone of i is than the cheapest in %, NaN without zone prices.
+func (i Instance) zoneSpread() float64 {
+	if len(i.SpotZones) == 0 || i.SpotZones[0].Price <= 0 {
+		return math.NaN()
+	}
+	return (i.SpotZones[len(i.SpotZones)-1].Price - i.SpotZones[0].Price) / i.SpotZones[0].Price * 100
+}
+
+// cheapestZoneDesc describes the cheapest zone of i for display i.e. "us-east-1c ($0.0271)".
+func (i Instance) cheapestZoneDesc() string {
+	if len(i.SpotZones) == 0 {
+		return "N/A"
+	}
+	return i.SpotZones[0].Zone + " ($" + strconv.FormatFloat(i.SpotZones[0].Price, 'f', 4, 64) + ")"
+}
+
+// placeInZones spreads n instances across the azs cheapest of zones. It returns the average spot price per
+// instance of the placement and a description of it i.e. "us-east-1c x2, us-east-1a x1", false if there are too few
+// zones or instances.
+func placeInZones(zones []ZonePrice, n int, azs int) (float64, string, bool) {
+	if azs < 1 || len(zones) < azs || n < azs {
+		return 0, "", false
+	}
+	var total float64
+	var plan []string
+	for z := 0; z < azs; z++ {
+		count := n / azs
+		if z < n%azs {
+			count++
+		}
+		total += zones[z].Price * float64(count)
+		plan = append(plan, zones[z].Zone+" x"+strconv.Itoa(count))
+	}
+	return total / float64(n), strings.Join(plan, ", "), true
+}
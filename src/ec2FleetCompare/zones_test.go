@@ -0,0 +1,55 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// nearly compares prices computed in floating point.
+func nearly(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestPlaceInZones(t *testing.T) {
+	zones := []ZonePrice{{"us-east-1c", 0.02}, {"us-east-1a", 0.03}, {"us-east-1b", 0.04}}
+	tests := []struct {
+		n, azs int
+		price  float64
+		plan   string
+		ok     bool
+	}{
+		{3, 3, 0.03, "us-east-1c x1, us-east-1a x1, us-east-1b x1", true},
+		{4, 3, 0.0275, "us-east-1c x2, us-east-1a x1, us-east-1b x1", true},
+		{5, 2, 0.024, "us-east-1c x3, us-east-1a x2", true},
+		{7, 1, 0.02, "us-east-1c x7", true},
+		{2, 3, 0, "", false},
+		{4, 4, 0, "", false},
+		{4, 0, 0, "", false},
+	}
+	for _, tt := range tests {
+		price, plan, ok := placeInZones(zones, tt.n, tt.azs)
+		if ok != tt.ok || plan != tt.plan || (ok && !nearly(price, tt.price)) {
+			t.Errorf("%d over %d: got %v %q %v, want %v %q %v", tt.n, tt.azs, price, plan, ok, tt.price, tt.plan, tt.ok)
+		}
+	}
+}
+
+func TestLatestZonePrices(t *testing.T) {
+	points := []SpotPricePoint{
+		{"us-east-1a", 0.05, at(0)},
+		{"us-east-1a", 0.03, at(2)},
+		{"us-east-1b", 0.02, at(1)},
+		{"us-east-1c", 0.03, at(0)},
+		{"us-east-1b", 0.04, at(3)},
+	}
+	want := []ZonePrice{{"us-east-1a", 0.03}, {"us-east-1c", 0.03}, {"us-east-1b", 0.04}}
+	got := latestZonePrices(points)
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for n := range want {
+		if got[n] != want[n] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}